@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/tdewolff/canvas"
+)
+
+// Frames that specify a delay this short (or none at all) are shown for DefaultFrameDelay instead, which
+// is consistent with how web browsers treat them.
+var MinFrameDelay = 20 * time.Millisecond
+var DefaultFrameDelay = 100 * time.Millisecond
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// An animation is a decoded sequence of fully-composited frames, each of which is displayed for its own
+// delay.  Still images are represented as an animation with a single frame.
+type animation struct {
+	frames []image.Image
+	delays []time.Duration
+	loops  int
+}
+
+// Load a still or animated (GIF or APNG) image from the given file.
+func loadAnimation(filename string) (*animation, error) {
+	if data, err := fileutil.ReadAll(filename); err == nil {
+		var anim *animation
+
+		if bytes.HasPrefix(data, []byte(`GIF8`)) {
+			anim, err = decodeGIF(data)
+		} else if bytes.HasPrefix(data, []byte(pngSignature)) {
+			anim, err = decodeAPNG(data)
+		} else if img, _, derr := image.Decode(bytes.NewReader(data)); derr == nil {
+			anim = &animation{
+				frames: []image.Image{img},
+				delays: []time.Duration{0},
+			}
+		} else {
+			err = derr
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", filename, err)
+		}
+
+		return anim, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Return whether the animation has more than one frame.
+func (self *animation) Animated() bool {
+	return self != nil && len(self.frames) > 1
+}
+
+// Return the frame at the given index.
+func (self *animation) Frame(i int) image.Image {
+	if self == nil || len(self.frames) == 0 {
+		return nil
+	}
+
+	return self.frames[i%len(self.frames)]
+}
+
+// Return how long the frame at the given index should be displayed for.
+func (self *animation) Delay(i int) time.Duration {
+	if d := self.delays[i%len(self.delays)]; d >= MinFrameDelay {
+		return d
+	}
+
+	return DefaultFrameDelay
+}
+
+// Return the index of the frame that follows the given one, and whether the animation should continue
+// at all.  plays is the number of times the animation has already run to completion.
+func (self *animation) Next(i int, plays int) (int, int, bool) {
+	if i++; i >= len(self.frames) {
+		i = 0
+		plays++
+
+		if self.loops > 0 && plays >= self.loops {
+			return len(self.frames) - 1, plays, false
+		}
+	}
+
+	return i, plays, true
+}
+
+func decodeGIF(data []byte) (*animation, error) {
+	var g, err = gif.DecodeAll(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds = image.Rect(0, 0, g.Config.Width, g.Config.Height)
+
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+
+	var anim = new(animation)
+	var surface = image.NewRGBA(bounds)
+
+	switch {
+	case g.LoopCount == 0:
+		anim.loops = 0
+	case g.LoopCount < 0:
+		anim.loops = 1
+	default:
+		anim.loops = g.LoopCount + 1
+	}
+
+	for i, frame := range g.Image {
+		var disposal byte
+		var previous *image.RGBA
+
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(surface)
+		}
+
+		draw.Draw(surface, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		anim.frames = append(anim.frames, cloneRGBA(surface))
+		anim.delays = append(anim.delays, time.Duration(g.Delay[i])*10*time.Millisecond)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(surface, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			surface = previous
+		}
+	}
+
+	if len(anim.frames) == 0 {
+		return nil, fmt.Errorf("no frames")
+	}
+
+	return anim, nil
+}
+
+// the frame control (fcTL) chunk of an APNG, along with the image data that belongs to it.
+type apngFrame struct {
+	width   uint32
+	height  uint32
+	x       int
+	y       int
+	delay   time.Duration
+	dispose byte
+	blend   byte
+	data    []byte
+}
+
+// Decodes an animated PNG.  The standard library only understands the default image in the file, so
+// each frame's data is repackaged as a standalone PNG (sharing the palette and other ancillary chunks of
+// the original), decoded, and composited.  PNGs without an animation control chunk decode as a still.
+func decodeAPNG(data []byte) (*animation, error) {
+	var ihdr []byte
+	var shared [][]byte
+	var frames []*apngFrame
+	var current *apngFrame
+	var animated bool
+	var loops int
+	var rest = data[len(pngSignature):]
+
+	for len(rest) >= 12 {
+		var length = binary.BigEndian.Uint32(rest[0:4])
+
+		if uint64(len(rest)) < 12+uint64(length) {
+			return nil, fmt.Errorf("truncated chunk")
+		}
+
+		var ctype = string(rest[4:8])
+		var cdata = rest[8 : 8+length]
+		var chunk = rest[:12+length]
+
+		rest = rest[12+length:]
+
+		switch ctype {
+		case `IHDR`:
+			ihdr = cdata
+		case `acTL`:
+			if len(cdata) < 8 {
+				return nil, fmt.Errorf("invalid acTL chunk")
+			}
+
+			animated = true
+			loops = int(binary.BigEndian.Uint32(cdata[4:8]))
+		case `fcTL`:
+			if len(cdata) < 26 {
+				return nil, fmt.Errorf("invalid fcTL chunk")
+			}
+
+			var num = binary.BigEndian.Uint16(cdata[20:22])
+			var den = binary.BigEndian.Uint16(cdata[22:24])
+
+			if den == 0 {
+				den = 100
+			}
+
+			current = &apngFrame{
+				width:   binary.BigEndian.Uint32(cdata[4:8]),
+				height:  binary.BigEndian.Uint32(cdata[8:12]),
+				x:       int(binary.BigEndian.Uint32(cdata[12:16])),
+				y:       int(binary.BigEndian.Uint32(cdata[16:20])),
+				delay:   time.Duration(num) * time.Second / time.Duration(den),
+				dispose: cdata[24],
+				blend:   cdata[25],
+			}
+
+			frames = append(frames, current)
+		case `IDAT`:
+			if current != nil {
+				current.data = append(current.data, cdata...)
+			}
+		case `fdAT`:
+			if current != nil && len(cdata) > 4 {
+				current.data = append(current.data, cdata[4:]...)
+			}
+		case `IEND`:
+		default:
+			if current == nil {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+
+	if !animated || len(frames) == 0 {
+		if img, err := png.Decode(bytes.NewReader(data)); err == nil {
+			return &animation{
+				frames: []image.Image{img},
+				delays: []time.Duration{0},
+			}, nil
+		} else {
+			return nil, err
+		}
+	}
+
+	if len(ihdr) < 13 {
+		return nil, fmt.Errorf("missing IHDR chunk")
+	}
+
+	var anim = &animation{
+		loops: loops,
+	}
+
+	var surface = image.NewRGBA(image.Rect(
+		0,
+		0,
+		int(binary.BigEndian.Uint32(ihdr[0:4])),
+		int(binary.BigEndian.Uint32(ihdr[4:8])),
+	))
+
+	for i, frame := range frames {
+		var buf bytes.Buffer
+		var header = append([]byte(nil), ihdr...)
+
+		binary.BigEndian.PutUint32(header[0:4], frame.width)
+		binary.BigEndian.PutUint32(header[4:8], frame.height)
+
+		buf.WriteString(pngSignature)
+		writePNGChunk(&buf, `IHDR`, header)
+
+		for _, chunk := range shared {
+			buf.Write(chunk)
+		}
+
+		writePNGChunk(&buf, `IDAT`, frame.data)
+		writePNGChunk(&buf, `IEND`, nil)
+
+		var img, err = png.Decode(&buf)
+
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", i, err)
+		}
+
+		var region = image.Rect(frame.x, frame.y, frame.x+int(frame.width), frame.y+int(frame.height))
+		var previous *image.RGBA
+		var op = draw.Over
+
+		if frame.dispose == 2 {
+			previous = cloneRGBA(surface)
+		}
+
+		if frame.blend == 0 {
+			op = draw.Src
+		}
+
+		draw.Draw(surface, region, img, img.Bounds().Min, op)
+
+		anim.frames = append(anim.frames, cloneRGBA(surface))
+		anim.delays = append(anim.delays, frame.delay)
+
+		switch frame.dispose {
+		case 1:
+			draw.Draw(surface, region, image.Transparent, image.Point{}, draw.Src)
+		case 2:
+			surface = previous
+		}
+	}
+
+	return anim, nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, ctype string, data []byte) {
+	var header [8]byte
+
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	copy(header[4:8], ctype)
+
+	buf.Write(header[:])
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(append(header[4:8:8], data...)))
+}
+
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	var dst = image.NewRGBA(src.Bounds())
+
+	copy(dst.Pix, src.Pix)
+
+	return dst
+}
+
+// load the image named by the button's image property whenever it changes, and select the current frame.
+func (self *Button) syncImage() {
+	if v := self._property(`ImageFile`).String(); v != self.evaluatedImage {
+		self.evaluatedImage = v
+		self.setAnimation(nil)
+
+		if v != `` && self.page != nil && self.page.deck != nil {
+			if anim, err := loadAnimation(self.page.deck.resolve(v)); err == nil {
+				self.setAnimation(anim)
+			} else {
+				log.Warningf("btn[%d]: image: %v", self.Index, err)
+			}
+		}
+	}
+
+	if self.animation != nil {
+		self.image = self.animation.Frame(self.frame)
+	}
+}
+
+// replace the image being displayed, starting any animation over from the first frame.
+func (self *Button) setAnimation(anim *animation) {
+	if t := self.frameTimer; t != nil {
+		t.Stop()
+		self.frameTimer = nil
+	}
+
+	self.animation = anim
+	self.frame = 0
+	self.plays = 0
+	self.animationDone = false
+	self.image = anim.Frame(0)
+}
+
+// Schedule the next frame of the button's animation, if it has one.  Every key keeps its own schedule so
+// that each animation plays at its own pace, and only the keys whose frame has changed are redrawn.
+// Animations pause while the button is not on display, and resume the next time it is rendered.
+func (self *Button) animate() {
+	var anim = self.animation
+
+	if !anim.Animated() || self.animationDone || self.frameTimer != nil {
+		return
+	}
+
+	self.frameTimer = time.AfterFunc(anim.Delay(self.frame), func() {
+		var deck = self.page.deck
+
+		deck.renderLock.Lock()
+		defer deck.renderLock.Unlock()
+
+		self.frameTimer = nil
+
+		if self.animation != anim {
+			return
+		}
+
+		var next, plays, more = anim.Next(self.frame, self.plays)
+
+		self.frame = next
+		self.plays = plays
+		self.animationDone = !more
+
+		if deck.Online() && self.onDisplay() {
+			if err := self.Render(); err != nil {
+				log.Warningf("btn[%d]: %v", self.Index, err)
+			}
+		}
+	})
+}
+
+// return whether this button is the one currently being shown on its key (or the touch strip).
+func (self *Button) onDisplay() bool {
+	if self.page == nil || self.page.deck == nil || self.page.deck.CurrentPage() != self.page {
+		return false
+	} else if self.strip {
+		return self.page.Strip == self
+	} else {
+		return self.key() > 0
+	}
+}
+
+// the resolution at which an image fills the button canvas, regardless of its pixel size.
+func imageResolution(img image.Image) canvas.Resolution {
+	var size = img.Bounds().Dx()
+
+	if h := img.Bounds().Dy(); h > size {
+		size = h
+	}
+
+	return canvas.DPMM(float64(size) / ButtonCanvasSize)
+}
@@ -7,9 +7,9 @@ import (
 	"image/png"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ghetzel/diecast"
 	"github.com/ghetzel/go-stockutil/colorutil"
@@ -41,6 +41,30 @@ var EntityMap = func() (m sync.Map) {
 
 const MultiActionSeparator = `->`
 
+// The actions that can be triggered by buttons, dials, and the touch strip.  Each action is given as
+// "VERB" or "VERB:ARGUMENT", and several can be chained together with MultiActionSeparator.
+var ActionVerbs = []string{
+	`shell`,
+	`page`,
+	`replace`,
+	`back`,
+	`home`,
+	`prev`,
+	`next`,
+	`http`,
+	`state`,
+	`cycle`,
+	`brightness`,
+	`cleardata`,
+	`set`,
+	`increment`,
+	`decrement`,
+}
+
+// The logical width and height of the surface buttons are drawn on.  This is scaled to the
+// native key size of the device when rasterized.
+const ButtonCanvasSize = 72
+
 var templateFunctions = func() diecast.FuncMap {
 	var fm = diecast.GetStandardFunctions(nil)
 
@@ -96,16 +120,25 @@ type Button struct {
 	ProgressColor string             `yaml:"progressColor" default:"#FFFFFF"`
 	Maximum       string             `yaml:"maximum"`
 	Action        string             `yaml:"action"`
+	OnPress       string             `yaml:"onPress"`
+	OnRelease     string             `yaml:"onRelease"`
+	OnLongPress   string             `yaml:"onLongPress"`
+	OnDoubleTap   string             `yaml:"onDoubleTap"`
+	HoldThreshold string             `yaml:"holdThreshold" default:"500ms"`
 	State         string             `yaml:"state"`
 	Cycle         []string           `yaml:"cycle"`
 	States        map[string]*Button `yaml:"states"`
 	Layers        []*Button          `yaml:"layers"`
+	ImageFile     string             `yaml:"image"`
 	// Visible           string             `yaml:"visible"`
 	auto              bool
+	filler            int
 	sticky            bool
+	strip             bool
 	override          *Button
 	evaluatedText     string
 	evaluatedIcon     string
+	evaluatedImage    string
 	evaluatedAction   string
 	overrideState     string
 	evaluatedState    string
@@ -121,6 +154,13 @@ type Button struct {
 	visualArena       *canvas.Canvas
 	fontFamily        *canvas.FontFamily
 	hasChanges        bool
+	stale             bool
+	fingerprint       string
+	animation         *animation
+	frame             int
+	plays             int
+	frameTimer        *time.Timer
+	animationDone     bool
 }
 
 func NewButton(page *Page, i int) *Button {
@@ -142,7 +182,7 @@ func (self *Button) MarshalJSON() ([]byte, error) {
 		Alias: (*Alias)(self),
 		Image: fmt.Sprintf(
 			"/deckhand/v1/decks/%s/%s/%d/image/?state=%s",
-			self.page.deck.Name,
+			self.page.deck.ID(),
 			self.page.Name,
 			self.Index,
 			self.evaluatedState,
@@ -188,7 +228,12 @@ func (self *Button) Reset() {
 	self.Fill = ``
 	self.Text = ``
 	self.Action = ``
+	self.OnPress = ``
+	self.OnRelease = ``
+	self.OnLongPress = ``
+	self.OnDoubleTap = ``
 	self.State = ``
+	self.ImageFile = ``
 	self.States = nil
 	self.FontName = ``
 	self.FontSize = 0
@@ -205,8 +250,18 @@ func (self *Button) SetProperty(propname string, value interface{}) {
 		self.Text = typeutil.String(value)
 	case `action`:
 		self.Action = typeutil.String(value)
+	case `onPress`:
+		self.OnPress = typeutil.String(value)
+	case `onRelease`:
+		self.OnRelease = typeutil.String(value)
+	case `onLongPress`:
+		self.OnLongPress = typeutil.String(value)
+	case `onDoubleTap`:
+		self.OnDoubleTap = typeutil.String(value)
 	case `icon`:
 		self.Icon = typeutil.String(value)
+	case `image`:
+		self.ImageFile = typeutil.String(value)
 	case `state`:
 		self.State = typeutil.String(value)
 	case `fontSize`:
@@ -229,7 +284,7 @@ func (self *Button) isReady() bool {
 		return false
 	}
 
-	if self.page.deck.device == nil {
+	if !self.page.deck.Online() {
 		return false
 	}
 
@@ -279,18 +334,14 @@ func (self *Button) _property(name string) typeutil.Variant {
 }
 
 // Uses the existing values that have already been parsed from the various files and evaluates them.
+// The button is only redrawn if something that affects its appearance has changed since the last time.
 func (self *Button) regen() {
-	self.visualArena = canvas.New(72, 72)
-
 	// if visible := self._property(`Visible`); visible.String() != `` && !visible.Bool() {
 	// 	self.Reset()
 	// 	return
 	// }
 
-	if v := self._property(`State`).String(); v != self.evaluatedState || self.evaluatedState == `` {
-		self.evaluatedState = v
-		self.hasChanges = true
-	}
+	self.evaluatedState = self._property(`State`).String()
 
 	if v := self._property(`Icon`).String(); v != `` {
 		if ico, ok := self.page.deck.Icons[v]; ok {
@@ -299,56 +350,78 @@ func (self *Button) regen() {
 		} else {
 			self.override = nil
 		}
-	}
 
-	if v := self._property(`Action`).String(); v != self.evaluatedAction || self.evaluatedAction == `` {
-		self.evaluatedAction = v
-		self.hasChanges = true
+		self.evaluatedIcon = v
 	}
 
-	if v := self._property(`Progress`).Float(); v != self.evaluatedProgress || self.evaluatedProgress == 0 {
-		self.evaluatedProgress = v
-		self.hasChanges = true
-	}
+	self.evaluatedAction = self._property(`Action`).String()
+	self.evaluatedProgress = self._property(`Progress`).Float()
+	self.evaluatedMaximum = self._property(`Maximum`).Float()
 
-	if v := self._property(`Maximum`).Float(); v != self.evaluatedMaximum || self.evaluatedMaximum == 0 {
-		self.evaluatedMaximum = v
-		self.hasChanges = true
-	}
-
-	if v := self._property(`Text`).String(); v != self.evaluatedText || self.evaluatedText == `` {
-		var lines = strings.Split(v, "\n")
+	var lines = strings.Split(self._property(`Text`).String(), "\n")
 
-		for i, line := range lines {
-			if repl := maputil.M(&EntityMap).String(line); repl != `` {
-				lines[i] = repl
-			}
+	for i, line := range lines {
+		if repl := maputil.M(&EntityMap).String(line); repl != `` {
+			lines[i] = repl
 		}
+	}
+
+	self.evaluatedText = strings.Join(lines, "\n")
+	self.syncImage()
+
+	var fill = self.colorProperty(`Fill`, `#000000`)
+	var tile = self.wallpaperTile()
+	var failed = !self.strip && self.page.HelperError() != nil
+	var fingerprint = fmt.Sprintf(
+		"%s|%s|%v|%v|%v|%v|%v|%s|%p|%d|%p|%t",
+		self.evaluatedState,
+		self.evaluatedText,
+		self.evaluatedProgress,
+		self.evaluatedMaximum,
+		fill,
+		self._property(`Color`),
+		self._property(`FontSize`),
+		self.evaluatedIcon,
+		self.animation,
+		self.frame,
+		tile,
+		failed,
+	)
 
-		self.evaluatedText = strings.Join(lines, "\n")
+	if fingerprint != self.fingerprint {
+		self.fingerprint = fingerprint
 		self.hasChanges = true
 	}
 
-	if !self.hasChanges {
+	if !self.hasChanges && self.visualArena != nil {
 		return
 	}
 
+	self.visualArena = canvas.New(self.canvasSize())
+	self.stale = true
+
 	var ctx = canvas.NewContext(self.visualArena)
 
-	ctx.SetFillColor(colorutil.MustParse(self._property(`Fill`).String()).NativeRGBA())
-	ctx.SetStrokeColor(canvas.Transparent)
-	ctx.DrawPath(
-		0,
-		0,
-		canvas.RoundedRectangle(
-			self.visualArena.W,
-			self.visualArena.H,
-			self.visualArena.H*0.2,
-		),
-	)
+	if tile != nil {
+		ctx.DrawImage(0, 0, tile, self.resolution())
+	}
+
+	if tile == nil || hidesWallpaper(fill) {
+		ctx.SetFillColor(fill.NativeRGBA())
+		ctx.SetStrokeColor(canvas.Transparent)
+		ctx.DrawPath(
+			0,
+			0,
+			canvas.RoundedRectangle(
+				self.visualArena.W,
+				self.visualArena.H,
+				self.visualArena.H*0.2,
+			),
+		)
+	}
 
 	if img := self.image; img != nil {
-		ctx.DrawImage(0, 0, img, 1)
+		ctx.DrawImage(0, 0, img, imageResolution(img))
 	}
 
 	if fontName := self._property(`FontName`).String(); self.fontFamily == nil && fontName != `` {
@@ -366,7 +439,7 @@ func (self *Button) regen() {
 	if self.fontFamily != nil {
 		var face = self.fontFamily.Face(
 			self._property(`FontSize`).Float(),
-			colorutil.MustParse(self._property(`Color`).String()).NativeRGBA(),
+			self.colorProperty(`Color`, `#FFFFFF`).NativeRGBA(),
 			canvas.FontRegular,
 			canvas.FontNormal,
 		)
@@ -385,6 +458,15 @@ func (self *Button) regen() {
 		ctx.DrawText(0, ctx.Height(), text)
 	}
 
+	// every key on the page is marked while the page's helper is failing
+	if failed {
+		var r = self.visualArena.H * 0.06
+
+		ctx.SetFillColor(colorutil.MustParse(`red`).NativeRGBA())
+		ctx.SetStrokeColor(canvas.Transparent)
+		ctx.DrawPath(self.visualArena.W-(2*r), self.visualArena.H-(2*r), canvas.Circle(r))
+	}
+
 	// if maximum := self.evaluatedMaximum; maximum > 0 {
 	// 	ctx.SetFillColor(canvas.Transparent)
 	// 	ctx.SetStrokeColor(colorutil.MustParse(self._property(`ProgressColor`).String()).NativeRGBA())
@@ -398,34 +480,86 @@ func (self *Button) regen() {
 	self.hasChanges = false
 }
 
+// return the value of a color property, or the given fallback if it is not a valid color.
+func (self *Button) colorProperty(name string, fallback string) colorutil.Color {
+	var value = self._property(name).String()
+
+	if c, err := parseColor(value); err == nil {
+		return c
+	} else {
+		log.Debugf("btn[%d]: %s: %v", self.Index, strings.ToLower(name), err)
+		return colorutil.MustParse(fallback)
+	}
+}
+
+// Parse a color value.  Unlike colorutil.Parse, values that aren't recognizable as a color name, hex
+// code, or rgb()/hsl()/hsv() expression are rejected rather than being treated as black.
+func parseColor(value string) (colorutil.Color, error) {
+	var v = strings.ToLower(strings.TrimSpace(value))
+
+	if _, ok := colorutil.ColorNames[v]; ok || rxutil.IsMatchString(`^(#?[0-9a-f]{6}([0-9a-f]{2})?|(rgba?|hs[lv]a?)\(.*\))$`, v) {
+		return colorutil.Parse(v)
+	}
+
+	return colorutil.Color{}, fmt.Errorf("invalid color %q", value)
+}
+
+// Display the given still or animated image on the button.
 func (self *Button) SetImage(filename string) error {
 	if !self.isReady() {
 		return nil
 	}
 
-	self.image = nil
+	self.setAnimation(nil)
 
-	if f, err := os.Open(filename); err == nil {
-		img, _, err := image.Decode(f)
-		f.Close()
-
-		if err == nil {
-			self.image = img
-			return nil
-		} else {
-			return err
-		}
+	if anim, err := loadAnimation(filename); err == nil {
+		self.setAnimation(anim)
+		return nil
 	} else {
 		return err
 	}
 }
 
+// rasterize the button canvas at whatever resolution yields the deck's native key size.
+func (self *Button) resolution() canvas.Resolution {
+	var model = self.model()
+
+	if self.strip {
+		return canvas.DPMM(float64(model.StripH) / ButtonCanvasSize)
+	} else {
+		return canvas.DPMM(float64(model.KeySize) / ButtonCanvasSize)
+	}
+}
+
+// return the logical width and height of the surface this button is drawn on.  Touch strips
+// are as tall as a key, and as wide as their aspect ratio dictates.
+func (self *Button) canvasSize() (float64, float64) {
+	if model := self.model(); self.strip && model.HasStrip() {
+		return ButtonCanvasSize * float64(model.StripW) / float64(model.StripH), ButtonCanvasSize
+	} else {
+		return ButtonCanvasSize, ButtonCanvasSize
+	}
+}
+
+func (self *Button) model() *Model {
+	if self.page != nil && self.page.deck != nil {
+		return self.page.deck.model()
+	} else {
+		return DefaultModel
+	}
+}
+
 func (self *Button) RenderTo(w io.Writer) error {
+	if self.page != nil && self.page.deck != nil {
+		self.page.deck.renderLock.Lock()
+		defer self.page.deck.renderLock.Unlock()
+	}
+
 	self.regen()
 
 	if rendered := rasterizer.Draw(
 		self.visualArena,
-		canvas.DPI(72),
+		self.resolution(),
 		canvas.DefaultColorSpace,
 	); rendered != nil {
 		return png.Encode(w, rendered)
@@ -434,19 +568,36 @@ func (self *Button) RenderTo(w io.Writer) error {
 	return nil
 }
 
+// Draw the button to its key on the deck.  Keys are only rasterized and sent to the device when their
+// appearance has changed.
 func (self *Button) Render() error {
 	if self.page == nil {
 		return nil
 	}
 
+	var key = self.key()
+
+	if !self.strip && key == 0 {
+		return nil
+	}
+
 	self.regen()
+	defer self.animate()
+
+	if !self.stale {
+		return nil
+	}
 
 	if rendered := rasterizer.Draw(
 		self.visualArena,
-		canvas.DPI(72),
+		self.resolution(),
 		canvas.DefaultColorSpace,
 	); rendered != nil {
-		if err := self.page.deck.device.WriteRawImageToButton(self.Index-1, rendered); err != nil {
+		self.stale = false
+
+		if self.strip {
+			return self.page.deck.writeStrip(rendered)
+		} else if err := self.page.deck.writeImage(key-1, rendered); err != nil {
 			return err
 		}
 	}
@@ -470,15 +621,25 @@ func (self *Button) Sync() error {
 	return nil
 }
 
+// Run the button's default action.
 func (self *Button) Trigger() error {
+	return self.runActions(self.evaluatedAction)
+}
+
+// Run the actions associated with a specific gesture (e.g.: OnLongPress, OnRelease).
+func (self *Button) TriggerGesture(property string) error {
+	return self.runActions(self._property(property).String())
+}
+
+func (self *Button) runActions(actions string) error {
 	if !self.isReady() {
 		return nil
 	}
 
 	defer self.Sync()
 
-	if self.evaluatedAction != `` {
-		for _, actionPair := range strings.Split(self.evaluatedAction, MultiActionSeparator) {
+	if actions != `` {
+		for _, actionPair := range strings.Split(actions, MultiActionSeparator) {
 			actionPair = strings.TrimSpace(actionPair)
 
 			var action, arg = stringutil.SplitPair(actionPair, `:`)
@@ -491,32 +652,61 @@ func (self *Button) Trigger() error {
 			switch action {
 			case `shell`:
 				if arg != `` {
-					var cmd = executil.ShellCommand(arg)
-					cmd.InheritEnv = true
+					if command, secrets, err := interpolateShell(arg); err == nil {
+						var cmd = executil.ShellCommand(command)
+						cmd.InheritEnv = true
 
-					terr = cmd.Run()
+						for i, v := range secrets {
+							cmd.SetEnv(shellValueVar(i), v)
+						}
+
+						terr = redact(cmd.Run(), secrets)
+					} else {
+						terr = err
+					}
 				} else {
 					terr = fmt.Errorf("Action 'shell' must be given an argument")
 				}
-			case `page`:
+			case `page`, `replace`:
 				var pg, rest = stringutil.SplitPairTrimSpace(arg, `;`)
 
-				self.page.deck.Page = pg
-				terr = self.page.deck.Sync()
+				if action == `page` {
+					terr = self.page.deck.PushPage(pg)
+				} else {
+					terr = self.page.deck.SetPage(pg)
+				}
 
 				if pg := self.page.deck.CurrentPage(); pg != nil {
 					pg.setDataFromArgLine(rest, autotypePageData)
 				}
 
+			case `prev`:
+				self.page.turn(-1)
+
+			case `next`:
+				self.page.turn(1)
+
+			case `back`:
+				terr = self.page.deck.Back()
+
+			case `home`:
+				terr = self.page.deck.GoHome()
+
 			case `http`:
 				var httpargs = rxutil.Split(`\s+`, arg)
 
 				if len(httpargs) < 2 {
 					terr = fmt.Errorf("usage: http:method url")
-				} else {
+				} else if uri, secrets, err := interpolate(httpargs[1]); err == nil {
 					var method string = strings.ToUpper(httpargs[0])
 
-					if client, err := httputil.NewClient(httpargs[1]); err == nil {
+					if client, err := httputil.NewClient(uri); err == nil {
+						// never dump requests carrying secrets, even when debugging
+						if len(secrets) > 0 {
+							client.SetPreRequestHook(nil)
+							client.SetPostRequestHook(nil)
+						}
+
 						if _, err := client.Request(
 							httputil.Method(method),
 							``,
@@ -524,11 +714,13 @@ func (self *Button) Trigger() error {
 							nil,
 							nil,
 						); err != nil {
-							terr = err
+							terr = redact(err, secrets)
 						}
 					} else {
-						terr = err
+						terr = redact(err, secrets)
 					}
+				} else {
+					terr = err
 				}
 
 			case `state`:
@@ -542,6 +734,9 @@ func (self *Button) Trigger() error {
 					terr = self.Sync()
 				}
 
+			case `brightness`:
+				terr = self.page.deck.adjustBrightness(arg)
+
 			case `cleardata`:
 				self.page.data = maputil.M(nil)
 
@@ -3,22 +3,23 @@ package main
 //go:generate esc -o static.go -pkg main -modtime 1500000000 -prefix ui ui
 
 import (
+	"crypto/sha256"
 	"fmt"
-	"net/http"
-	"os"
+	"image"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghetzel/deckhand/clutch"
-	"github.com/ghetzel/diecast"
 	"github.com/ghetzel/go-stockutil/executil"
 	"github.com/ghetzel/go-stockutil/fileutil"
-	"github.com/ghetzel/go-stockutil/httputil"
 	"github.com/ghetzel/go-stockutil/log"
 	"github.com/ghetzel/go-stockutil/maputil"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
 	"github.com/ghetzel/sysfact"
-	streamdeck "github.com/magicmonkey/go-streamdeck"
 	"github.com/mcuadros/go-defaults"
 	"github.com/radovskyb/watcher"
 	"gopkg.in/yaml.v2"
@@ -27,12 +28,11 @@ import (
 var DeckhandDir = executil.RootOrString(`/etc/deckhand`, `~/.config/deckhand`)
 var DeckhandLockFile = `draw.lock`
 var systemReport map[string]interface{}
+var systemReportOnce sync.Once
+var systemReportLock sync.RWMutex
 
-type UpdateDeckRequest struct {
-	Button
-	Deck string
-	Page string
-}
+// How often to check whether a disconnected device has been reattached.
+var ReconnectInterval = 2 * time.Second
 
 // A Deck represents the configuration details for a specific StreamDeck device.
 // Buttons are organized into Pages, which can be navigated between and configured
@@ -56,25 +56,81 @@ type UpdateDeckRequest struct {
 //  This output would clear all configurations on the current page, then set
 //  button 1 (top-left) to the text "Hello There", with a magenta background,
 //  and would run the shell command "/bin/true" when pressed.
+//
+//  Helpers can also stay running and write lines like these whenever something
+//  changes (see Helper).
 
 type Deck struct {
-	Name        string
-	Page        string            `yaml:"-" default:"default"`
-	Pages       map[string]*Page  `yaml:"pages"`
-	Rows        int               `yaml:"rows"`
-	Cols        int               `yaml:"cols"`
-	Helpers     map[string]string `yaml:"helpers"`
-	Icons       map[string]Button `yaml:"icons"`
-	DataSources clutch.Store      `yaml:"data"`
-	Count       int               `yaml:"-"`
-	device      *streamdeck.Device
-	watcher     *watcher.Watcher
-	filename    string
+	Name           string
+	Serial         string             `yaml:"-"`
+	Page           string             `yaml:"-" default:"default"`
+	Home           string             `yaml:"-" default:"default"`
+	Pages          map[string]*Page   `yaml:"pages"`
+	Rows           int                `yaml:"rows"`
+	Cols           int                `yaml:"cols"`
+	Brightness     int                `yaml:"brightness" default:"100"`
+	Idle           *IdleConfig        `yaml:"idle"`
+	Pagination     *Pagination        `yaml:"pagination"`
+	Rules          []*Rule            `yaml:"rules"`
+	Include        []string           `yaml:"include"`
+	Helpers        map[string]*Helper `yaml:"helpers"`
+	Icons          map[string]Button  `yaml:"icons"`
+	DataSources    clutch.Store       `yaml:"data"`
+	Count          int                `yaml:"-"`
+	Model          *Model             `yaml:"-"`
+	device         Device
+	online         bool
+	deviceLock     sync.RWMutex
+	renderLock     sync.Mutex
+	brightness     int
+	lastPressAt    time.Time
+	idling         bool
+	wakePage       string
+	entered        string
+	enteredAt      time.Time
+	pageIdle       bool
+	history        []string
+	rules          map[string]*ruleState
+	rulesCheckedAt time.Time
+	ruleLock       sync.Mutex
+	navLock        sync.Mutex
+	idleLock       sync.Mutex
+	gestures       gestureTracker
+	mirror         frameMirror
+	watcher        *watcher.Watcher
+	filename       string
+	files          []string
+	snapshot       map[string]string
+	written        map[string][sha256.Size]byte
+	writeLock      sync.Mutex
+	stop           chan bool
+}
+
+// Describes what a deck should do after it has gone untouched for a period of time.  The deck can
+// be dimmed, switched to a screensaver page, or both.  The first key press afterwards restores
+// the deck, and does not trigger that key's action.
+type IdleConfig struct {
+	Timeout    string `yaml:"timeout"`
+	Brightness *int   `yaml:"brightness"`
+	Page       string `yaml:"page"`
+}
+
+// Return the path to the configuration for the deck with the given serial number.  If no
+// configuration exists specifically for that device, the default configuration is used.
+func DeckConfigPath(serial string) string {
+	if serial != `` {
+		if filename := filepath.Join(DeckhandDir, serial, `deck.yaml`); fileutil.IsNonemptyFile(fileutil.MustExpandUser(filename)) {
+			return filename
+		}
+	}
+
+	return filepath.Join(DeckhandDir, `default`, `deck.yaml`)
 }
 
 func LoadDeck(filename string) (*Deck, error) {
 	var deck = new(Deck)
 	deck.filename = filename
+	deck.stop = make(chan bool)
 	return deck, deck.load(filename)
 }
 
@@ -86,17 +142,45 @@ func OpenDeck(filename string) (*Deck, error) {
 	}
 }
 
+// Load the configuration that corresponds to the given device's serial number, and attach
+// the device to it.
+func AttachDeck(device Device) (*Deck, error) {
+	if deck, err := LoadDeck(DeckConfigPath(device.Serial())); err == nil {
+		return deck, deck.Attach(device)
+	} else {
+		return nil, err
+	}
+}
+
 func (self *Deck) load(filename string) error {
 	filename = fileutil.MustExpandUser(filename)
 
-	if data, err := fileutil.ReadAll(filename); err == nil {
-		if err := yaml.Unmarshal(data, self); err == nil {
-			self.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if doc, files, err := loadConfigFile(filename, nil); err == nil {
+		if err := resolvePageExtends(doc); err != nil {
+			return err
+		}
+
+		var data, err = yaml.Marshal(doc)
 
-			return nil
-		} else {
+		if err != nil {
 			return err
 		}
+
+		self.Pages = nil
+		self.files = sliceutil.UniqueStrings(files)
+
+		err = yaml.Unmarshal(data, self)
+
+		// type errors still leave us with everything that could be decoded, which is enough to validate against
+		if _, ok := err.(*yaml.TypeError); err == nil || ok {
+			self.Name = filepath.Base(filepath.Dir(filename))
+
+			if perr := self.loadPageDir(); perr != nil {
+				return perr
+			}
+		}
+
+		return err
 	} else {
 		return err
 	}
@@ -106,48 +190,367 @@ func (self *Deck) Filename() string {
 	return fileutil.MustExpandUser(self.filename)
 }
 
+// Open the first Stream Deck attached via USB and attach it to this deck.
 func (self *Deck) Open() error {
-	if device, err := streamdeck.Open(); err == nil {
-		switch self.Name {
-		case ``, `default`:
-			self.Name = `default`
+	if device, err := OpenUSBDevice(``); err == nil {
+		return self.Attach(device)
+	} else {
+		return err
+	}
+}
+
+// Attach the given device to this deck, register for key presses, and perform an initial sync.
+func (self *Deck) Attach(device Device) error {
+	switch self.Name {
+	case ``, `default`:
+		self.Name = `default`
+	}
+
+	self.bind(device)
+	self.checkConfig()
+
+	device.Clear()
+
+	if err := self.Sync(); err != nil {
+		return err
+	}
+
+	self.lastPressAt = time.Now()
+
+	return self.SetBrightness(self.Brightness)
+}
+
+// make the given device the one this deck renders to and receives presses from.
+func (self *Deck) bind(device Device) {
+	self.deviceLock.Lock()
+	defer self.deviceLock.Unlock()
+
+	self.device = device
+	self.online = true
+	self.Serial = device.Serial()
+	self.Model = device.Model()
+	self.Rows = self.Model.Rows
+	self.Cols = self.Model.Cols
+	self.Count = self.Model.Keys()
+
+	device.OnKey(func(i int, pressed bool, err error) {
+		if err == nil {
+			self.keyEvent(i, pressed)
+		} else {
+			self.disconnected(device, err)
 		}
+	})
+
+	device.OnInput(self.inputEvent)
+}
 
-		self.device = device
+// called when a device reports that it can no longer be read from.  Rendering is paused
+// and we start looking for the device to come back.
+func (self *Deck) disconnected(device Device, err error) {
+	self.deviceLock.Lock()
 
-		self.device.ButtonPress(func(i int, d *streamdeck.Device, err error) {
-			if err == nil {
-				if err := self.trigger(i); err != nil {
-					log.Errorf("btn[%d]: %v", i, err)
+	if self.device != device || !self.online {
+		self.deviceLock.Unlock()
+		return
+	}
+
+	self.online = false
+	self.deviceLock.Unlock()
+
+	log.Warningf("deck %v: device disconnected: %v", self.ID(), err)
+	device.Close()
+
+	go self.reconnect()
+}
+
+// polls for the device with this deck's serial number until it reappears or the deck is closed.  A device
+// whose serial number couldn't be read can't be told apart from any other, so it isn't looked for.
+func (self *Deck) reconnect() {
+	if self.Serial == `` {
+		log.Warningf("deck %v: device has no serial number, so it will not be reconnected", self.ID())
+		return
+	}
+
+	var ticker = time.NewTicker(ReconnectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if device, err := OpenUSBDevice(self.Serial); err == nil {
+				self.bind(device)
+				device.Clear()
+				self.applyBrightness()
+
+				if pg := self.CurrentPage(); pg != nil {
+					if err := pg.Sync(); err != nil {
+						log.Warningf("deck %v: %v", self.ID(), err)
+					}
 				}
 
-				self.CurrentPage().Sync()
+				log.Infof("deck %v: device reconnected", self.ID())
+				return
 			}
-		})
-
-		switch strings.ToLower(device.GetName()) {
-		case `streamdeck (original v2)`:
-			self.Rows = 3
-			self.Cols = 5
+		case <-self.stop:
+			return
 		}
+	}
+}
+
+// Return whether the deck's device is currently attached and usable.
+func (self *Deck) Online() bool {
+	self.deviceLock.RLock()
+	defer self.deviceLock.RUnlock()
+
+	return (self.device != nil && self.online)
+}
+
+// write the given image to a key on the device, so long as the device is online.
+func (self *Deck) writeImage(index int, img image.Image) error {
+	self.mirror.publish(index+1, false, img)
+
+	self.deviceLock.RLock()
+	defer self.deviceLock.RUnlock()
+
+	if self.device != nil && self.online {
+		return self.device.WriteImage(index, img)
+	}
 
-		self.Count = (self.Rows * self.Cols)
+	return nil
+}
 
-		device.ClearButtons()
+// Set the brightness of the deck's device, from 0-100.
+func (self *Deck) SetBrightness(percent int) error {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
 
-		return self.Sync()
+	self.brightness = percent
+
+	return self.applyBrightness()
+}
+
+// adjusts brightness to an absolute value ("50"), or relative to the current brightness ("+10", "-10").
+func (self *Deck) adjustBrightness(arg string) error {
+	arg = strings.TrimSpace(arg)
+
+	if v, err := strconv.Atoi(arg); err == nil {
+		if strings.HasPrefix(arg, `+`) || strings.HasPrefix(arg, `-`) {
+			return self.SetBrightness(self.brightness + v)
+		} else {
+			return self.SetBrightness(v)
+		}
 	} else {
-		return err
+		return fmt.Errorf("invalid brightness %q", arg)
 	}
 }
 
+// sends the current brightness to the device, dimming to the idle brightness instead if the deck is idle.
+func (self *Deck) applyBrightness() error {
+	var percent = self.brightness
+
+	self.idleLock.Lock()
+
+	if self.idling && self.Idle != nil && self.Idle.Brightness != nil {
+		percent = *self.Idle.Brightness
+	}
+
+	self.idleLock.Unlock()
+
+	self.deviceLock.RLock()
+	defer self.deviceLock.RUnlock()
+
+	if self.device != nil && self.online {
+		return self.device.SetBrightness(percent)
+	}
+
+	return nil
+}
+
+// puts the deck into its idle state if it has gone untouched for longer than the idle timeout.
+func (self *Deck) checkIdle() {
+	if self.Idle == nil || (self.Idle.Brightness == nil && self.Idle.Page == ``) {
+		return
+	}
+
+	var timeout = typeutil.Duration(self.Idle.Timeout)
+
+	self.idleLock.Lock()
+
+	if self.idling || timeout <= 0 || time.Since(self.lastPressAt) < timeout {
+		self.idleLock.Unlock()
+		return
+	}
+
+	self.idling = true
+	self.wakePage = self.Page
+	self.idleLock.Unlock()
+
+	log.Debugf("deck %v: idle after %v", self.ID(), timeout)
+
+	if err := self.applyBrightness(); err != nil {
+		log.Warningf("deck %v: %v", self.ID(), err)
+	}
+
+	if pg := self.Idle.Page; pg != `` && pg != self.Page {
+		if err := self.SetPage(pg); err != nil {
+			log.Warningf("deck %v: %v", self.ID(), err)
+		}
+	}
+}
+
+// runs the onIdle actions of the current page if it has been showing, untouched, for longer than its idle
+// timeout.  These run once per visit to the page, and again only after the deck has been touched.
+func (self *Deck) checkPageIdle() {
+	var page = self.CurrentPage()
+
+	if page == nil || page.OnIdle == `` {
+		return
+	}
+
+	var timeout = typeutil.Duration(page.IdleTimeout)
+
+	self.idleLock.Lock()
+
+	var since = self.lastPressAt
+
+	if self.enteredAt.After(since) {
+		since = self.enteredAt
+	}
+
+	if self.pageIdle || timeout <= 0 || page.Name != self.entered || time.Since(since) < timeout {
+		self.idleLock.Unlock()
+		return
+	}
+
+	self.pageIdle = true
+	self.idleLock.Unlock()
+
+	log.Debugf("deck %v: page %v idle after %v", self.ID(), page.Name, timeout)
+	page.runHook(`onIdle`, page.OnIdle)
+}
+
+// runs the onExit actions of the page that was last entered and the onEnter actions of the current
+// page, if the current page has changed since the last time this was called.
+func (self *Deck) enterPage() {
+	var page = self.CurrentPage()
+
+	if page == nil {
+		return
+	}
+
+	self.idleLock.Lock()
+
+	if page.Name == self.entered {
+		self.idleLock.Unlock()
+		return
+	}
+
+	var previous = self.entered
+
+	self.entered = page.Name
+	self.enteredAt = time.Now()
+	self.pageIdle = false
+	self.idleLock.Unlock()
+
+	if previous != `` {
+		if pg, ok := self.Pages[previous]; ok {
+			pg.stopHelperStream()
+			pg.runHook(`onExit`, pg.OnExit)
+		}
+	}
+
+	page.runHook(`onEnter`, page.OnEnter)
+}
+
+// records a key press, and marks the deck as no longer idle.  Returns true if the deck was idle, in which
+// case the press should not be acted upon, and resume should be called to restore the deck.
+func (self *Deck) wake() bool {
+	self.idleLock.Lock()
+	defer self.idleLock.Unlock()
+
+	self.lastPressAt = time.Now()
+	self.pageIdle = false
+
+	if !self.idling {
+		return false
+	}
+
+	self.idling = false
+	return true
+}
+
+// restores the brightness and page that the deck had before it went idle.  Switching back to the page
+// syncs it, which can take a while, so this shouldn't be called while holding up other input.
+func (self *Deck) resume() {
+	self.idleLock.Lock()
+	var wakePage = self.wakePage
+	self.idleLock.Unlock()
+
+	log.Debugf("deck %v: waking up", self.ID())
+
+	if err := self.applyBrightness(); err != nil {
+		log.Warningf("deck %v: %v", self.ID(), err)
+	}
+
+	if wakePage != self.Page {
+		if err := self.SetPage(wakePage); err != nil {
+			log.Warningf("deck %v: %v", self.ID(), err)
+		}
+	}
+}
+
+// Switch the deck to the named page.
+func (self *Deck) SetPage(name string) error {
+	self.Page = name
+	return self.Sync()
+}
+
+// write the given image to the device's touch strip, so long as the device is online.
+func (self *Deck) writeStrip(img image.Image) error {
+	self.mirror.publish(0, true, img)
+
+	self.deviceLock.RLock()
+	defer self.deviceLock.RUnlock()
+
+	if self.device != nil && self.online {
+		return self.device.WriteStrip(img)
+	}
+
+	return nil
+}
+
+// Return a channel that receives every image displayed on the deck from now on, starting with
+// the images currently on display.  The returned function must be called when done.
+func (self *Deck) Subscribe() (<-chan *Frame, func()) {
+	return self.mirror.Subscribe()
+}
+
 func (self *Deck) Clear() error {
-	self.device.ClearButtons()
+	self.deviceLock.RLock()
+	defer self.deviceLock.RUnlock()
+
+	if self.device != nil && self.online {
+		return self.device.Clear()
+	}
+
 	return nil
 }
 
+// Return the most recent report of the system's state (updated every second while a deck is running).
+func currentSystemReport() map[string]interface{} {
+	systemReportLock.RLock()
+	defer systemReportLock.RUnlock()
+
+	return systemReport
+}
+
 func (self *Deck) Sync() error {
-	if err := self.load(self.filename); err != nil {
+	var diff, err = self.reload()
+
+	if err != nil {
 		return err
 	}
 
@@ -157,66 +560,141 @@ func (self *Deck) Sync() error {
 		return err
 	}
 
-	for name, pg := range self.Pages {
-		pg.deck = self
-		pg.Name = name
-
-		if pg.Name == self.Page {
-			// if cur := self.CurrentPage(); pg.Name != cur.Name {
-			// 	cur.DataSources.Close()
-			// }
-
-			if err := pg.Sync(); err != nil {
-				return fmt.Errorf("page %v: %v", name, err)
+	if current := self.CurrentPage(); current != nil {
+		self.idleLock.Lock()
+		var switched = (current.Name != self.entered)
+		self.idleLock.Unlock()
+
+		// every key is still showing the previous page, so a new page is synced (and redrawn) in full, but
+		// staying on the same page only needs whatever the reload changed.  Keys are repainted in place on
+		// the next render rather than being blanked first.
+		if switched {
+			if err := current.Sync(); err != nil {
+				return fmt.Errorf("page %v: %v", current.Name, err)
 			}
-
-			self.Clear()
-			break
+		} else if err := self.syncChanges(diff); err != nil {
+			return err
 		}
 	}
 
 	if self.watcher == nil {
 		self.watcher = watcher.New()
-		self.watcher.SetMaxEvents(1)
 
 		go func() {
 			for {
 				select {
-				case <-self.watcher.Event:
-					self.Sync()
+				case event := <-self.watcher.Event:
+					self.fileChanged(event.Path)
+				case err := <-self.watcher.Error:
+					log.Warningf("deck %v: watcher: %v", self.ID(), err)
 				case <-self.watcher.Closed:
 					return
 				}
 			}
 		}()
 
-		self.watcher.Add(self.Filename())
 		go self.watcher.Start(250 * time.Millisecond)
 
-		go func() {
-			for range time.NewTicker(1000 * time.Millisecond).C {
-				if sysreport, err := sysfact.Report(); err == nil {
-					systemReport, _ = maputil.DiffuseMap(sysreport, `.`)
+		systemReportOnce.Do(func() {
+			go func() {
+				for range time.NewTicker(1000 * time.Millisecond).C {
+					if sysreport, err := sysfact.Report(); err == nil {
+						var report, _ = maputil.DiffuseMap(sysreport, `.`)
+
+						systemReportLock.Lock()
+						systemReport = report
+						systemReportLock.Unlock()
+					}
 				}
-			}
-		}()
+			}()
+		})
 	}
 
+	self.watchConfigFiles()
+	self.watchPageDir()
+	self.watchReferencedFiles()
+	self.enterPage()
+
 	return nil
 }
 
 func (self *Deck) Close() error {
+	select {
+	case <-self.stop:
+	default:
+		close(self.stop)
+	}
+
+	for _, pg := range self.Pages {
+		pg.stopHelperStream()
+	}
+
+	if self.watcher != nil {
+		self.watcher.Close()
+	}
+
+	self.deviceLock.Lock()
+	defer self.deviceLock.Unlock()
+
 	if self.device != nil {
+		self.online = false
 		self.device.Close()
 	}
 
 	return nil
 }
 
+// Render the current page to the device on the given interval until the deck is closed.
+func (self *Deck) Run(interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			self.checkIdle()
+			self.checkPageIdle()
+			self.checkRules()
+
+			if err := self.Render(); err != nil {
+				log.Warningf("deck %v: %v", self.ID(), err)
+			}
+		case <-self.stop:
+			return
+		}
+	}
+}
+
+// Return the value that uniquely identifies this deck: the serial number of its device if
+// one is attached, or the deck name otherwise.
+func (self *Deck) ID() string {
+	if self.Serial != `` {
+		return self.Serial
+	} else {
+		return self.Name
+	}
+}
+
 func (self *Deck) path(filename ...string) string {
 	return filepath.Join(append([]string{fileutil.MustExpandUser(DeckhandDir), self.Name}, filename...)...)
 }
 
+// Return the absolute path of a file referenced in the deck config.  Relative paths are relative to the
+// deck's config directory.
+func (self *Deck) resolve(filename string) string {
+	filename = fileutil.MustExpandUser(filename)
+
+	if !filepath.IsAbs(filename) {
+		filename = self.path(filename)
+	}
+
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+
+	return filename
+}
+
 func (self *Deck) CurrentPage() *Page {
 	var currentPage = `default`
 
@@ -231,93 +709,29 @@ func (self *Deck) CurrentPage() *Page {
 	}
 }
 
-func (self *Deck) Render() error {
-	if pg := self.CurrentPage(); pg != nil {
-		return pg.Render()
-	} else {
-		return nil
-	}
+// Return the pixel width and height of the keys on this deck's device.
+func (self *Deck) KeySize() int {
+	return self.model().KeySize
 }
 
-func (self *Deck) ListenAndServe(address string) error {
-	var server = diecast.NewServer(os.Getenv(`UI`))
-
-	if dcyml := self.path(`diecast.yml`); fileutil.IsNonemptyFile(dcyml) {
-		if err := server.LoadConfig(dcyml); err == nil {
-			log.Infof("loaded supplementary config: %v", dcyml)
-		} else {
-			return err
-		}
+func (self *Deck) model() *Model {
+	if self.Model != nil {
+		return self.Model
+	} else {
+		return DefaultModel
 	}
+}
 
-	if server.RootPath == `` {
-		server.SetFileSystem(FS(false))
+func (self *Deck) Render() error {
+	if !self.Online() {
+		return nil
 	}
 
-	server.Get(`/deckhand/v1/`, func(w http.ResponseWriter, req *http.Request) {
-		httputil.RespondJSON(w, `ok`)
-	})
-
-	server.Get(`/deckhand/v1/report/`, func(w http.ResponseWriter, req *http.Request) {
-		httputil.RespondJSON(w, systemReport)
-	})
-
-	server.Get(`/deckhand/v1/decks/`, func(w http.ResponseWriter, req *http.Request) {
-		httputil.RespondJSON(w, []*Deck{self})
-	})
-
-	server.Get(`/deckhand/v1/decks/:deck/`, func(w http.ResponseWriter, req *http.Request) {
-		httputil.RespondJSON(w, self)
-	})
-
-	server.Get(`/deckhand/v1/decks/:deck/:page/:button/_render/`, func(w http.ResponseWriter, req *http.Request) {
-		var page = server.P(req, `page`).String()
-		var bidx = int(server.P(req, `button`).Int())
-
-		if pg, ok := self.Pages[page]; ok {
-			if btn, ok := pg.Buttons[bidx]; ok {
-				w.Header().Set(`Content-Type`, `image/png`)
-				btn.RenderTo(w)
-			} else {
-				httputil.RespondJSON(w, fmt.Errorf("no button %d", bidx), http.StatusNotFound)
-			}
-		} else {
-			httputil.RespondJSON(w, fmt.Errorf("no such page %q", page), http.StatusNotFound)
-		}
-	})
-
-	server.Get(`/deckhand/v1/decks/:deck/:page/:button/:property/`, func(w http.ResponseWriter, req *http.Request) {
-		var page = server.P(req, `page`).String()
-		var bidx = int(server.P(req, `button`).Int())
-		var prop = server.P(req, `property`).String()
+	self.renderLock.Lock()
+	defer self.renderLock.Unlock()
 
-		if pg, ok := self.Pages[page]; ok {
-			if btn, ok := pg.Buttons[bidx]; ok {
-				btn.ServeProperty(w, req, prop)
-			} else {
-				httputil.RespondJSON(w, fmt.Errorf("no button %d", bidx), http.StatusNotFound)
-			}
-		} else {
-			httputil.RespondJSON(w, fmt.Errorf("no such page %q", page), http.StatusNotFound)
-		}
-	})
-
-	server.Post(`/deckhand/v1/decks/`, func(w http.ResponseWriter, req *http.Request) {
-		var ureq UpdateDeckRequest
-
-		if err := httputil.ParseRequest(req, &ureq); err == nil {
-
-		} else {
-			httputil.RespondJSON(w, err)
-		}
-	})
-
-	return server.ListenAndServe(address)
-}
-
-func (self *Deck) trigger(btn int) error {
 	if pg := self.CurrentPage(); pg != nil {
-		return pg.trigger(btn + 1)
+		return pg.Render()
 	} else {
 		return nil
 	}
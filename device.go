@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+)
+
+// A KeyFunc is called whenever a key on a Device is pressed or released.  The index is zero-based.
+// If the device encountered an error reading key state, index will be -1 and err will be set.
+type KeyFunc func(index int, pressed bool, err error)
+
+type InputKind string
+
+const (
+	DialTurn    InputKind = `turn`
+	DialPress   InputKind = `press`
+	DialRelease InputKind = `release`
+	Touch       InputKind = `touch`
+	LongTouch   InputKind = `longtouch`
+	Swipe       InputKind = `swipe`
+)
+
+// An InputEvent describes input from something other than a key, such as the dials and touch
+// strip on the Stream Deck Plus.  Dial indices are zero-based, touch coordinates are in pixels
+// relative to the top-left of the touch strip.
+type InputEvent struct {
+	Kind  InputKind
+	Dial  int
+	Delta int
+	X     int
+	Y     int
+	ToX   int
+	ToY   int
+}
+
+// An InputFunc is called whenever a Device reports non-key input.
+type InputFunc func(event InputEvent)
+
+// A Device represents anything that can display button images and report key presses
+// back to a Deck.  This is usually a physical Stream Deck attached via USB, but may also
+// be a VirtualDevice for running without hardware.
+type Device interface {
+	Model() *Model
+	Serial() string
+	OnKey(fn KeyFunc)
+	OnInput(fn InputFunc)
+	WriteImage(index int, img image.Image) error
+	WriteStrip(img image.Image) error
+	Clear() error
+	SetBrightness(percent int) error
+	Close() error
+}
+
+// A VirtualDevice is an in-memory Device that records every frame written to each of
+// its keys, and allows presses to be injected programmatically.
+type VirtualDevice struct {
+	model      *Model
+	serial     string
+	brightness int
+	frames     map[int]image.Image
+	writes     map[int]int
+	listeners  []KeyFunc
+	inputs     []InputFunc
+	strip      image.Image
+	closed     bool
+	lock       sync.RWMutex
+}
+
+// Create a new virtual device that emulates the given model.  If model is nil, DefaultModel is used.
+func NewVirtualDevice(model *Model, serial string) *VirtualDevice {
+	if model == nil {
+		model = DefaultModel
+	}
+
+	return &VirtualDevice{
+		model:      model,
+		serial:     serial,
+		brightness: 100,
+		frames:     make(map[int]image.Image),
+		writes:     make(map[int]int),
+	}
+}
+
+func (self *VirtualDevice) Model() *Model {
+	return self.model
+}
+
+func (self *VirtualDevice) Serial() string {
+	return self.serial
+}
+
+func (self *VirtualDevice) OnKey(fn KeyFunc) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.listeners = append(self.listeners, fn)
+}
+
+func (self *VirtualDevice) OnInput(fn InputFunc) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.inputs = append(self.inputs, fn)
+}
+
+func (self *VirtualDevice) WriteStrip(img image.Image) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.closed {
+		return fmt.Errorf("device is closed")
+	} else if !self.model.HasStrip() {
+		return fmt.Errorf("%s does not have a touch strip", self.model.Name)
+	}
+
+	self.strip = img
+	return nil
+}
+
+func (self *VirtualDevice) WriteImage(index int, img image.Image) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.closed {
+		return fmt.Errorf("device is closed")
+	} else if index < 0 || index >= self.model.Keys() {
+		return fmt.Errorf("key %d out of range", index)
+	}
+
+	self.frames[index] = img
+	self.writes[index] += 1
+
+	return nil
+}
+
+func (self *VirtualDevice) Clear() error {
+	var blank = image.NewRGBA(image.Rect(0, 0, self.model.KeySize, self.model.KeySize))
+
+	draw.Draw(blank, blank.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	for i := 0; i < self.model.Keys(); i++ {
+		if err := self.WriteImage(i, blank); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *VirtualDevice) SetBrightness(percent int) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+
+	self.brightness = percent
+	return nil
+}
+
+func (self *VirtualDevice) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.closed = true
+	return nil
+}
+
+// Simulate pressing and then immediately releasing the key at the given zero-based index.
+func (self *VirtualDevice) Press(index int) error {
+	if err := self.KeyDown(index); err != nil {
+		return err
+	}
+
+	return self.KeyUp(index)
+}
+
+// Simulate pressing down the key at the given zero-based index.
+func (self *VirtualDevice) KeyDown(index int) error {
+	return self.emit(index, true)
+}
+
+// Simulate releasing the key at the given zero-based index.
+func (self *VirtualDevice) KeyUp(index int) error {
+	return self.emit(index, false)
+}
+
+func (self *VirtualDevice) emit(index int, pressed bool) error {
+	if index < 0 || index >= self.model.Keys() {
+		return fmt.Errorf("key %d out of range", index)
+	}
+
+	self.lock.RLock()
+	var listeners = make([]KeyFunc, len(self.listeners))
+	copy(listeners, self.listeners)
+	self.lock.RUnlock()
+
+	for _, fn := range listeners {
+		fn(index, pressed, nil)
+	}
+
+	return nil
+}
+
+// Simulate an input event from a dial or the touch strip.
+func (self *VirtualDevice) Input(event InputEvent) error {
+	switch event.Kind {
+	case DialTurn, DialPress, DialRelease:
+		if event.Dial < 0 || event.Dial >= self.model.Dials {
+			return fmt.Errorf("dial %d out of range", event.Dial)
+		}
+	default:
+		if !self.model.HasStrip() {
+			return fmt.Errorf("%s does not have a touch strip", self.model.Name)
+		}
+	}
+
+	self.lock.RLock()
+	var inputs = make([]InputFunc, len(self.inputs))
+	copy(inputs, self.inputs)
+	self.lock.RUnlock()
+
+	for _, fn := range inputs {
+		fn(event)
+	}
+
+	return nil
+}
+
+// Return the most recent image written to the touch strip.
+func (self *VirtualDevice) Strip() image.Image {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.strip
+}
+
+// Return the most recent image written to the key at the given index.
+func (self *VirtualDevice) Frame(index int) image.Image {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.frames[index]
+}
+
+// Return the number of times an image has been written to the key at the given index.
+func (self *VirtualDevice) FrameCount(index int) int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.writes[index]
+}
+
+// Return the current brightness of the device, from 0-100.
+func (self *VirtualDevice) Brightness() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.brightness
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+// How long after a tap a second tap must arrive to be considered a double-tap.
+var DoubleTapWindow = 300 * time.Millisecond
+
+// tracks the in-progress gesture for a single physical key.
+type keyGesture struct {
+	held       bool
+	suppressed bool
+	holdTimer  *time.Timer
+	tapTimer   *time.Timer
+}
+
+type gestureTracker struct {
+	keys map[int]*keyGesture
+	lock sync.Mutex
+}
+
+func (self *gestureTracker) key(index int) *keyGesture {
+	if self.keys == nil {
+		self.keys = make(map[int]*keyGesture)
+	}
+
+	if _, ok := self.keys[index]; !ok {
+		self.keys[index] = new(keyGesture)
+	}
+
+	return self.keys[index]
+}
+
+// Interprets a key being pressed or released as one of the gestures a button can respond to.
+//
+//	onPress:     runs as soon as the key goes down.
+//	onRelease:   runs when the key comes back up.
+//	onLongPress: runs once the key has been held down for the button's holdThreshold.
+//	onDoubleTap: runs when the key is tapped twice within DoubleTapWindow.
+//	action:      the default behavior.  Runs as soon as the key goes down, unless the button
+//	             also responds to onLongPress or onDoubleTap, in which case it runs only when
+//	             the key is tapped once.
+func (self *Deck) keyEvent(index int, pressed bool) {
+	// actions (and waking the deck up) can take a while, so they run after the gesture state is updated and
+	// unlocked, rather than holding up events from every other key
+	var btn, gestures, woke = self.gesture(index, pressed)
+
+	if woke {
+		self.resume()
+		return
+	}
+
+	for _, property := range gestures {
+		self.fire(btn, property)
+	}
+}
+
+// update the gesture state of the given key, and return the button it belongs to along with the gesture
+// properties that should be fired, in order.  If the press woke the deck up, nothing is fired, and the
+// deck should be resumed instead.
+func (self *Deck) gesture(index int, pressed bool) (*Button, []string, bool) {
+	self.gestures.lock.Lock()
+	defer self.gestures.lock.Unlock()
+
+	var gesture = self.gestures.key(index)
+	var fire []string
+
+	if pressed {
+		if self.wake() {
+			gesture.suppressed = true
+			return nil, nil, true
+		}
+
+		gesture.suppressed = false
+		gesture.held = false
+	} else if gesture.suppressed {
+		gesture.suppressed = false
+		return nil, nil, false
+	}
+
+	var btn = self.buttonAt(index)
+
+	if btn == nil {
+		return nil, nil, false
+	}
+
+	var longPress = btn.hasAction(`OnLongPress`)
+	var doubleTap = btn.hasAction(`OnDoubleTap`)
+
+	if pressed {
+		fire = append(fire, `OnPress`)
+
+		if longPress {
+			gesture.holdTimer = time.AfterFunc(btn.holdThreshold(), func() {
+				self.gestures.lock.Lock()
+				gesture.held = true
+				self.gestures.lock.Unlock()
+
+				self.fire(btn, `OnLongPress`)
+			})
+		}
+
+		if !longPress && !doubleTap {
+			fire = append(fire, ``)
+		}
+	} else {
+		if t := gesture.holdTimer; t != nil {
+			t.Stop()
+			gesture.holdTimer = nil
+		}
+
+		if !gesture.held && (longPress || doubleTap) {
+			if doubleTap {
+				if t := gesture.tapTimer; t != nil && t.Stop() {
+					gesture.tapTimer = nil
+					fire = append(fire, `OnDoubleTap`)
+				} else {
+					gesture.tapTimer = time.AfterFunc(DoubleTapWindow, func() {
+						self.gestures.lock.Lock()
+						gesture.tapTimer = nil
+						self.gestures.lock.Unlock()
+
+						self.fire(btn, ``)
+					})
+				}
+			} else {
+				fire = append(fire, ``)
+			}
+		}
+
+		fire = append(fire, `OnRelease`)
+	}
+
+	return btn, fire, false
+}
+
+// runs the actions for the given gesture property on a button, or the default action if property is empty.
+func (self *Deck) fire(btn *Button, property string) {
+	var err error
+	var start = time.Now()
+
+	if property == `` {
+		if !btn.hasAction(`Action`) {
+			return
+		}
+
+		err = btn.Trigger()
+	} else if btn.hasAction(property) {
+		err = btn.TriggerGesture(property)
+	} else {
+		return
+	}
+
+	if err != nil {
+		log.Errorf("btn[%d]: %v", btn.Index, err)
+	}
+
+	// actions can change the page data that other buttons depend on, but ones that switched pages have
+	// already synced the page that is now showing
+	if pg := self.CurrentPage(); pg != nil && pg.lastSyncedAt.Before(start) {
+		pg.Sync()
+	}
+}
+
+// return the button on the current page that corresponds to the given zero-based key index.
+func (self *Deck) buttonAt(index int) *Button {
+	if pg := self.CurrentPage(); pg != nil {
+		return pg.buttonForKey(index + 1)
+	} else {
+		return nil
+	}
+}
+
+func (self *Button) hasAction(property string) bool {
+	return self._property(property).String() != ``
+}
+
+func (self *Button) holdThreshold() time.Duration {
+	if d := typeutil.Duration(self._property(`HoldThreshold`).String()); d > 0 {
+		return d
+	} else {
+		return 500 * time.Millisecond
+	}
+}
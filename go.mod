@@ -3,15 +3,17 @@ module github.com/ghetzel/deckhand
 go 1.18
 
 require (
+	github.com/disintegration/gift v1.2.1
 	github.com/ghetzel/cli v1.17.0
 	github.com/ghetzel/diecast v1.22.1
 	github.com/ghetzel/go-stockutil v1.11.3
 	github.com/ghetzel/sysfact v0.8.2
 	github.com/ghetzel/testify v1.4.1
-	github.com/magicmonkey/go-streamdeck v0.0.1-alpha
+	github.com/karalabe/hid v1.0.1-0.20190806082151-9c14560f9ee8
 	github.com/mcuadros/go-defaults v1.2.0
 	github.com/radovskyb/watcher v1.0.7
 	github.com/tdewolff/canvas v0.0.0-20221024234312-43156e2756af
+	golang.org/x/image v0.0.0-20220617043117-41969df76e82
 	gopkg.in/yaml.v2 v2.4.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -36,7 +38,6 @@ require (
 	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/diegomagdaleno/whatmac v0.0.1 // indirect
-	github.com/disintegration/gift v1.2.1 // indirect
 	github.com/dlclark/regexp2 v1.4.0 // indirect
 	github.com/dsnet/compress v0.0.1 // indirect
 	github.com/dustin/go-humanize v1.0.0 // indirect
@@ -73,7 +74,6 @@ require (
 	github.com/jsummers/gobmp v0.0.0-20151104160322-e2ba15ffa76e // indirect
 	github.com/jszwec/s3fs v0.4.0 // indirect
 	github.com/juliangruber/go-intersect v1.1.0 // indirect
-	github.com/karalabe/hid v1.0.1-0.20190806082151-9c14560f9ee8 // indirect
 	github.com/kellydunn/golang-geo v0.7.0 // indirect
 	github.com/kelvins/sunrisesunset v0.0.0-20210220141756-39fa1bd816d5 // indirect
 	github.com/kr/fs v0.1.0 // indirect
@@ -115,7 +115,6 @@ require (
 	github.com/ziutek/mymysql v1.5.4 // indirect
 	go.uber.org/atomic v1.6.0 // indirect
 	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29 // indirect
-	golang.org/x/image v0.0.0-20220617043117-41969df76e82 // indirect
 	golang.org/x/mod v0.6.0-dev.0.20220419223038-86c51ed26bb4 // indirect
 	golang.org/x/net v0.1.0 // indirect
 	golang.org/x/oauth2 v0.1.0 // indirect
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+const (
+	HelperOnce   = `once`
+	HelperStream = `stream`
+)
+
+const (
+	HelperSkip   = `skip`
+	HelperQueue  = `queue`
+	HelperCancel = `cancel`
+)
+
+// The modes that a helper can run in.
+var HelperModes = []string{HelperOnce, HelperStream}
+
+// What can happen when a helper is asked to run while it is already running.
+var HelperOverlaps = []string{HelperSkip, HelperQueue, HelperCancel}
+
+// How long a helper may run for if it doesn't specify a timeout.
+var DefaultHelperTimeout = 1 * time.Second
+
+// How long to wait before restarting a streaming helper that has exited.  The delay doubles each time the
+// helper exits in quick succession, up to HelperMaxBackoff, and goes back to HelperMinBackoff once it has
+// managed to stay up for longer than that.
+var HelperMinBackoff = 1 * time.Second
+var HelperMaxBackoff = 30 * time.Second
+
+// Helpers are defined under "helpers", keyed on the name that pages refer to them by.  A helper can be
+// given as just its script, or as a mapping with its settings:
+//
+//	helpers:
+//	  clock: |
+//	    echo "1.text=$(date +%H:%M)"
+//	  errors:
+//	    mode:   stream
+//	    script: |
+//	      tail -F /var/log/app.log | grep --line-buffered ERROR | while read -r line; do
+//	        echo "1.text=${line}"
+//	      done
+//
+// By default ("mode: once"), the helper runs each time the page is synced (and every "interval", if one
+// is set), and its output is applied when it exits.  It is killed if it runs for longer than "timeout".
+// If it is asked to run again before it has finished (e.g.: because a button was pressed), "overlap"
+// decides what happens:
+//
+//	skip    the new run is dropped (the default)
+//	queue   the helper runs again as soon as it finishes (however many times it was asked to meanwhile)
+//	cancel  the running helper is killed, and its output discarded, in favor of the new run
+//
+// Streaming helpers ("mode: stream") are started when their page is displayed, and each line of their
+// output is applied as soon as it is written.  They are restarted if they exit, and are stopped when the
+// deck moves to another page.  Timeout, interval, and overlap don't apply to them.
+//
+// If a helper fails or times out, every key on its page is marked with a red dot until it next succeeds,
+// and the error is available to templates as "helperError".
+type Helper struct {
+	Script   string `yaml:"script"`
+	Mode     string `yaml:"mode"     default:"once"`
+	Timeout  string `yaml:"timeout"  default:"1s"`
+	Interval string `yaml:"interval"`
+	Overlap  string `yaml:"overlap"  default:"skip"`
+}
+
+// helpers can be given as a string, which is their script.
+func (self *Helper) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var script string
+
+	if err := unmarshal(&script); err == nil {
+		self.Script = script
+		return nil
+	}
+
+	type plain Helper
+
+	return unmarshal((*plain)(self))
+}
+
+// the state of a page's streaming helper.
+type helperStream struct {
+	helper *Helper
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// a running helper, which can be killed (along with everything it started) from another goroutine.  Once
+// the helper has been waited on, its process group ID may be reused by something else entirely, so it is
+// no longer killed after that.
+type helperProcess struct {
+	cmd    *exec.Cmd
+	lock   sync.Mutex
+	waited bool
+}
+
+// kill the helper's process group, unless the helper has already been waited on.
+func (self *helperProcess) kill() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if !self.waited {
+		killProcessGroup(self.cmd)
+	}
+}
+
+// wait for the helper to exit (and for its output to be read).
+func (self *helperProcess) wait() error {
+	var err = self.cmd.Wait()
+
+	self.lock.Lock()
+	self.waited = true
+	self.lock.Unlock()
+
+	return err
+}
+
+// start the page's streaming helper, unless it is already running.
+func (self *Page) startHelperStream(helper *Helper) {
+	self.streamLock.Lock()
+	defer self.streamLock.Unlock()
+
+	if self.stream != nil {
+		if self.stream.helper == helper {
+			return
+		}
+
+		// the helper was replaced by a reload
+		self.stream.cancel()
+	}
+
+	var stream = &helperStream{
+		helper: helper,
+	}
+
+	stream.ctx, stream.cancel = context.WithCancel(context.Background())
+
+	self.stream = stream
+
+	go self.superviseHelper(stream)
+}
+
+// stop the page's streaming helper, if it has one running.  This doesn't wait for the helper to exit, but
+// nothing it writes from now on is applied to the page.
+func (self *Page) stopHelperStream() {
+	self.streamLock.Lock()
+	defer self.streamLock.Unlock()
+
+	if self.stream != nil {
+		self.stream.cancel()
+		self.stream = nil
+	}
+}
+
+// run a streaming helper until told to stop, restarting it (with backoff) whenever it exits.
+func (self *Page) superviseHelper(stream *helperStream) {
+	var backoff = HelperMinBackoff
+
+	for {
+		var start = time.Now()
+		var err = self.runHelperStream(stream)
+
+		if stream.ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(start) > HelperMaxBackoff {
+			backoff = HelperMinBackoff
+		}
+
+		if err == nil {
+			err = fmt.Errorf("exited")
+		}
+
+		self.setHelperError(err)
+		log.Warningf("helper %v: %v, restarting in %v", self.Helper, err, backoff)
+
+		select {
+		case <-stream.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > HelperMaxBackoff {
+			backoff = HelperMaxBackoff
+		}
+	}
+}
+
+// run a streaming helper once, applying each line of its output to the page as it arrives.  Returns when
+// the helper's output ends, or after killing it if told to stop.  Either way, the helper and everything it
+// started are killed and waited on before this returns.
+func (self *Page) runHelperStream(stream *helperStream) error {
+	self.deck.renderLock.Lock()
+	self.syncData()
+	var helperCmd, secrets, cleanup, err = self.helperCommand(stream.helper)
+	self.deck.renderLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	// the helper's output is read from pipes rather than copied, so that waiting for it to exit doesn't
+	// also wait on any processes it left behind that are still holding on to them
+	var logger = helperCmd.Stderr
+
+	helperCmd.Stderr = nil
+
+	var stdout, perr = helperCmd.StdoutPipe()
+	var stderr, eerr = helperCmd.StderrPipe()
+
+	if perr != nil {
+		return perr
+	} else if eerr != nil {
+		return eerr
+	}
+
+	// executil's own monitoring of the process would race with waiting on it below, so it is started directly
+	if helperCmd.InheritEnv {
+		helperCmd.Env = append(os.Environ(), helperCmd.Env...)
+	}
+
+	setProcessGroup(helperCmd.Cmd)
+
+	if err := helperCmd.Cmd.Start(); err != nil {
+		return redact(err, secrets)
+	}
+
+	go io.Copy(logger, stderr)
+
+	log.Debugf("helper %v: streaming", self.Helper)
+
+	var proc = &helperProcess{
+		cmd: helperCmd.Cmd,
+	}
+
+	var exited = make(chan bool)
+
+	go func() {
+		select {
+		case <-stream.ctx.Done():
+			proc.kill()
+			stdout.Close()
+			stderr.Close()
+		case <-exited:
+		}
+	}()
+
+	var scanner = bufio.NewScanner(stdout)
+	var ok bool
+
+	for scanner.Scan() {
+		self.deck.renderLock.Lock()
+
+		if stream.ctx.Err() != nil {
+			self.deck.renderLock.Unlock()
+			break
+		}
+
+		// the helper is working again
+		if !ok {
+			self.setHelperError(nil)
+			ok = true
+		}
+
+		for _, btn := range self.applyHelperLine(scanner.Text()) {
+			btn.Sync()
+		}
+
+		self.deck.renderLock.Unlock()
+	}
+
+	// its output has ended, so anything the helper left running is stopped before it is restarted (or
+	// abandoned), rather than piling up each time
+	proc.kill()
+
+	err = proc.wait()
+	close(exited)
+
+	return redact(err, secrets)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHelperTimeout(t *testing.T) {
+	// the echo keeps the shell from replacing itself with sleep, so that killing the shell alone would
+	// leave sleep running and holding on to the helper's output
+	var deck = newTestDeck(t, `helpers:
+  slow:
+    timeout: 300ms
+    script: |
+      sleep 5
+      echo "1.text=late"
+pages:
+  default:
+    helper: slow
+    buttons:
+      1: {text: one}
+`)
+
+	var start = time.Now()
+	var err = deck.CurrentPage().RunHelper()
+	var took = time.Since(start)
+
+	if err == nil || !strings.Contains(err.Error(), `timed out`) {
+		t.Fatalf("expected the helper to time out, got %v", err)
+	} else if took > time.Second {
+		t.Fatalf("expected the helper to be stopped at its timeout, but it took %v", took)
+	} else if deck.CurrentPage().HelperError() == nil {
+		t.Fatalf("expected the page to record the helper's error")
+	}
+}
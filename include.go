@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"gopkg.in/yaml.v2"
+)
+
+// Load a configuration file, along with any other files it includes.
+//
+// Deck configs can pull in shared fragments (e.g.: icons, helpers, or page defaults that are common to
+// several decks) by listing files or glob patterns under "include".  Relative paths are relative to the
+// directory of the file doing the including, and included files may include others in turn.
+//
+// Files are merged in a deterministic order: each include is merged in the order it is listed (with the
+// files matching a glob pattern merged in lexical order), and the including file is merged last.  Mappings
+// are merged key-by-key, at every level; for anything else (strings, numbers, lists), later files replace
+// whatever came before.
+//
+// Returns the merged document, and the names of all of the files it was assembled from.
+func loadConfigFile(filename string, including map[string]bool) (map[interface{}]interface{}, []string, error) {
+	if abs, err := filepath.Abs(fileutil.MustExpandUser(filename)); err == nil {
+		filename = abs
+	} else {
+		return nil, nil, err
+	}
+
+	if including == nil {
+		including = make(map[string]bool)
+	} else if including[filename] {
+		return nil, nil, fmt.Errorf("%s: include cycle detected", filename)
+	}
+
+	including[filename] = true
+	defer delete(including, filename)
+
+	var doc = make(map[interface{}]interface{})
+
+	if data, err := fileutil.ReadAll(filename); err == nil {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	} else {
+		return nil, nil, err
+	}
+
+	var merged = make(map[interface{}]interface{})
+	var patterns = includePatterns(doc[`include`])
+	var files []string
+
+	if len(patterns) > 0 {
+		doc[`include`] = patterns
+	}
+
+	for _, pattern := range patterns {
+		var path = fileutil.MustExpandUser(pattern)
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(filename), path)
+		}
+
+		var matches, err = filepath.Glob(path)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: include %q: %v", filename, pattern, err)
+		} else if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[`) {
+			return nil, nil, fmt.Errorf("%s: include %q: file not found", filename, pattern)
+		}
+
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			if sub, subfiles, err := loadConfigFile(match, including); err == nil {
+				merged = mergeConfig(merged, sub)
+				files = append(files, subfiles...)
+			} else {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return mergeConfig(merged, doc), append(files, filename), nil
+}
+
+// the "include" key may be a single filename or pattern, or a list of them.
+func includePatterns(value interface{}) []string {
+	var patterns []string
+
+	switch v := value.(type) {
+	case string:
+		patterns = append(patterns, v)
+	case []interface{}:
+		for _, item := range v {
+			if s := fmt.Sprintf("%v", item); s != `` {
+				patterns = append(patterns, s)
+			}
+		}
+	}
+
+	return patterns
+}
+
+// deep-merge two YAML documents, with values from the second taking precedence.
+func mergeConfig(base map[interface{}]interface{}, overlay map[interface{}]interface{}) map[interface{}]interface{} {
+	var out = make(map[interface{}]interface{}, len(base)+len(overlay))
+
+	for k, v := range base {
+		out[k] = v
+	}
+
+	for k, v := range overlay {
+		if ov, ok := v.(map[interface{}]interface{}); ok {
+			if bv, ok := out[k].(map[interface{}]interface{}); ok {
+				out[k] = mergeConfig(bv, ov)
+				continue
+			}
+		}
+
+		out[k] = v
+	}
+
+	return out
+}
+
+// start watching every file the deck's configuration was loaded from.
+func (self *Deck) watchConfigFiles() {
+	if self.watcher == nil {
+		return
+	}
+
+	var watched = self.watcher.WatchedFiles()
+
+	for _, filename := range self.files {
+		if _, ok := watched[filename]; !ok {
+			if err := self.watcher.Add(filename); err != nil {
+				log.Warningf("deck %v: cannot watch %v: %v", self.ID(), filename, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	var tests = []struct {
+		name  string
+		files map[string]string
+		want  string
+		err   string
+	}{
+		{
+			name: `no includes`,
+			files: map[string]string{
+				`deck.yaml`: "brightness: 50\n",
+			},
+			want: "brightness: 50\n",
+		}, {
+			name: `including file wins`,
+			files: map[string]string{
+				`deck.yaml`: "include: base.yaml\nbrightness: 50\n",
+				`base.yaml`: "brightness: 10\nrows: 2\n",
+			},
+			want: "include: [base.yaml]\nbrightness: 50\nrows: 2\n",
+		}, {
+			name: `mappings merge at every level, lists are replaced`,
+			files: map[string]string{
+				`deck.yaml`: "include: base.yaml\npages:\n  default:\n    buttons:\n      1: {text: mine}\n    tags: [c]\n",
+				`base.yaml`: "pages:\n  default:\n    buttons:\n      1: {text: theirs, color: red}\n      2: {text: two}\n    tags: [a, b]\n",
+			},
+			want: "include: [base.yaml]\npages:\n  default:\n    buttons:\n      1: {text: mine, color: red}\n      2: {text: two}\n    tags: [c]\n",
+		}, {
+			name: `includes merge in the order listed`,
+			files: map[string]string{
+				`deck.yaml`: "include: [b.yaml, a.yaml]\n",
+				`a.yaml`:    "name: a\n",
+				`b.yaml`:    "name: b\n",
+			},
+			want: "include: [b.yaml, a.yaml]\nname: a\n",
+		}, {
+			name: `globs merge in lexical order`,
+			files: map[string]string{
+				`deck.yaml`:          "include: 'shared/*.yaml'\n",
+				`shared/02-two.yaml`: "name: two\nrows: 2\n",
+				`shared/01-one.yaml`: "name: one\ncols: 1\n",
+			},
+			want: "include: ['shared/*.yaml']\nname: two\nrows: 2\ncols: 1\n",
+		}, {
+			name: `nested includes are relative to the including file`,
+			files: map[string]string{
+				`deck.yaml`:         "include: shared/icons.yaml\n",
+				`shared/icons.yaml`: "include: more.yaml\nicons: {a: one}\n",
+				`shared/more.yaml`:  "icons: {b: two}\n",
+			},
+			want: "include: [shared/icons.yaml]\nicons: {a: one, b: two}\n",
+		}, {
+			name: `a glob matching nothing is fine`,
+			files: map[string]string{
+				`deck.yaml`: "include: 'none/*.yaml'\nname: x\n",
+			},
+			want: "include: ['none/*.yaml']\nname: x\n",
+		}, {
+			name: `missing file`,
+			files: map[string]string{
+				`deck.yaml`: "include: nope.yaml\n",
+			},
+			err: `include "nope.yaml": file not found`,
+		}, {
+			name: `cycle`,
+			files: map[string]string{
+				`deck.yaml`: "include: a.yaml\n",
+				`a.yaml`:    "include: b.yaml\n",
+				`b.yaml`:    "include: a.yaml\n",
+			},
+			err: `a.yaml: include cycle detected`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root = writeTestFiles(t, tt.files)
+			var doc, files, err = loadConfigFile(filepath.Join(root, `deck.yaml`), nil)
+
+			if tt.err != `` {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+					t.Fatalf("expected an error ending in %q, got %v", tt.err, err)
+				}
+
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, filename := range files {
+				if rel, err := filepath.Rel(root, filename); err != nil || tt.files[rel] == `` {
+					t.Fatalf("unexpected file %v", filename)
+				}
+			}
+
+			if last := files[len(files)-1]; last != filepath.Join(root, `deck.yaml`) {
+				t.Fatalf("expected the including file to be merged last, got %v", files)
+			}
+
+			var want map[interface{}]interface{}
+
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(normalizeTestConfig(doc), normalizeTestConfig(want)) {
+				t.Fatalf("expected:\n%v\ngot:\n%v", want, doc)
+			}
+		})
+	}
+}
+
+func TestResolvePageExtends(t *testing.T) {
+	var tests = []struct {
+		name  string
+		pages string
+		want  string
+		err   string
+	}{
+		{
+			name:  `no extends`,
+			pages: "a: {refresh: 1s}\n",
+			want:  "a: {refresh: 1s}\n",
+		}, {
+			name:  `buttons merge property by property`,
+			pages: "base:\n  helper: clock\n  buttons:\n    1: {text: one, color: red}\n    2: {text: two}\nchild:\n  extends: base\n  buttons:\n    1: {text: uno}\n",
+			want:  "base:\n  helper: clock\n  buttons:\n    1: {text: one, color: red}\n    2: {text: two}\nchild:\n  extends: base\n  helper: clock\n  buttons:\n    1: {text: uno, color: red}\n    2: {text: two}\n",
+		}, {
+			name:  `chained`,
+			pages: "a: {helper: x, refresh: 1s}\nb: {extends: a, refresh: 2s}\nc: {extends: b, helperArgs: y}\n",
+			want:  "a: {helper: x, refresh: 1s}\nb: {extends: a, helper: x, refresh: 2s}\nc: {extends: b, helper: x, refresh: 2s, helperArgs: y}\n",
+		}, {
+			name:  `missing parent`,
+			pages: "a: {extends: nope}\n",
+			err:   `page a: cannot extend page "nope": no such page`,
+		}, {
+			name:  `self`,
+			pages: "a: {extends: a}\n",
+			err:   `extends cycle: a -> a`,
+		}, {
+			name:  `cycle`,
+			pages: "a: {extends: b}\nb: {extends: c}\nc: {extends: a}\n",
+			err:   `extends cycle`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages map[interface{}]interface{}
+
+			if err := yaml.Unmarshal([]byte(tt.pages), &pages); err != nil {
+				t.Fatal(err)
+			}
+
+			var doc = map[interface{}]interface{}{
+				`pages`: pages,
+			}
+
+			if err := resolvePageExtends(doc); tt.err != `` {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var want map[interface{}]interface{}
+
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(normalizeTestConfig(doc[`pages`]), normalizeTestConfig(want)) {
+				t.Fatalf("expected:\n%v\ngot:\n%v", want, doc[`pages`])
+			}
+		})
+	}
+}
+
+// the include list is rewritten as a list of strings, which would otherwise not compare equal to one
+// decoded from YAML.
+func normalizeTestConfig(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		var out = make(map[interface{}]interface{}, len(v))
+
+		for k, item := range v {
+			out[k] = normalizeTestConfig(item)
+		}
+
+		return out
+	case []string:
+		var out = make([]interface{}, len(v))
+
+		for i, item := range v {
+			out[i] = item
+		}
+
+		return out
+	case []interface{}:
+		var out = make([]interface{}, len(v))
+
+		for i, item := range v {
+			out[i] = normalizeTestConfig(item)
+		}
+
+		return out
+	default:
+		return value
+	}
+}
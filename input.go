@@ -0,0 +1,150 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/maputil"
+)
+
+// A Dial configures the actions that run when one of the rotary encoders on a Stream Deck Plus
+// is turned, pushed, or when the segment of the touch strip directly above it is touched.
+//
+// Before any dial action runs, the page data key "dial" is set to an object describing the event:
+// its (1-based) index, the number of detents it was turned ("delta", negative for counter-clockwise),
+// and whether it is currently pushed in.  This allows actions like "increment:volume={{ .dial.delta }}"
+// to drive page data directly.
+type Dial struct {
+	OnTurn      string `yaml:"onTurn"`
+	OnTurnLeft  string `yaml:"onTurnLeft"`
+	OnTurnRight string `yaml:"onTurnRight"`
+	OnPress     string `yaml:"onPress"`
+	OnRelease   string `yaml:"onRelease"`
+	OnTouch     string `yaml:"onTouch"`
+	pressed     bool
+}
+
+// Handles input from dials and the touch strip, dispatching the corresponding actions on the current page.
+func (self *Deck) inputEvent(event InputEvent) {
+	var start = time.Now()
+
+	// as with keys, the actions run once the gesture state has been updated and unlocked
+	var pg, actions, woke = self.input(event)
+
+	if woke {
+		self.resume()
+		return
+	} else if pg == nil {
+		return
+	}
+
+	for _, action := range actions {
+		if action != `` {
+			if err := pg.runActions(action); err != nil {
+				log.Errorf("%s[%d]: %v", event.Kind, event.Dial+1, err)
+			}
+		}
+	}
+
+	// the event changed the page data, but actions that switched pages have already synced the page that is
+	// now showing
+	if pg := self.CurrentPage(); pg != nil && pg.lastSyncedAt.Before(start) {
+		pg.Sync()
+	}
+}
+
+// update the state of the dials and the page data describing the event, and return the current page
+// along with the actions that the event should run, in order.  If the event woke the deck up, nothing
+// should be run, and the deck should be resumed instead.
+func (self *Deck) input(event InputEvent) (*Page, []string, bool) {
+	self.gestures.lock.Lock()
+	defer self.gestures.lock.Unlock()
+
+	if self.wake() {
+		return nil, nil, true
+	}
+
+	var pg = self.CurrentPage()
+
+	if pg == nil {
+		return nil, nil, false
+	}
+
+	var actions []string
+
+	switch event.Kind {
+	case DialTurn, DialPress, DialRelease:
+		var dial = pg.Dials[event.Dial+1]
+
+		if dial == nil {
+			return nil, nil, false
+		}
+
+		switch event.Kind {
+		case DialTurn:
+			actions = append(actions, dial.OnTurn)
+
+			if event.Delta < 0 {
+				actions = append(actions, dial.OnTurnLeft)
+			} else {
+				actions = append(actions, dial.OnTurnRight)
+			}
+		case DialPress:
+			dial.pressed = true
+			actions = append(actions, dial.OnPress)
+		case DialRelease:
+			dial.pressed = false
+			actions = append(actions, dial.OnRelease)
+		}
+
+		pg.setData(`dial`, map[string]interface{}{
+			`index`:   event.Dial + 1,
+			`delta`:   event.Delta,
+			`pressed`: dial.pressed,
+		})
+
+	case Touch, LongTouch, Swipe:
+		var model = self.model()
+		var segment = 0
+
+		if model.Dials > 0 && model.StripW > 0 {
+			segment = (event.X * model.Dials / model.StripW) + 1
+		}
+
+		switch event.Kind {
+		case Touch:
+			if dial := pg.Dials[segment]; dial != nil {
+				actions = append(actions, dial.OnTouch)
+			}
+
+			actions = append(actions, pg.OnTouch)
+		case LongTouch:
+			actions = append(actions, pg.OnLongTouch)
+		case Swipe:
+			if event.ToX < event.X {
+				actions = append(actions, pg.OnSwipeLeft)
+			} else {
+				actions = append(actions, pg.OnSwipeRight)
+			}
+		}
+
+		pg.setData(`touch`, map[string]interface{}{
+			`x`:       event.X,
+			`y`:       event.Y,
+			`toX`:     event.ToX,
+			`toY`:     event.ToY,
+			`segment`: segment,
+		})
+	}
+
+	return pg, actions, false
+}
+
+// Set a single key in the page data.
+func (self *Page) setData(key string, value interface{}) {
+	if self.data == nil {
+		self.data = maputil.M(nil)
+	}
+
+	self.data.Set(key, value)
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/ghetzel/cli"
+	"github.com/ghetzel/go-stockutil/fileutil"
 	"github.com/ghetzel/go-stockutil/log"
-	_ "github.com/magicmonkey/go-streamdeck/devices"
 )
 
 func main() {
@@ -40,33 +42,125 @@ func main() {
 			Value:  `127.0.0.1:17925`,
 			EnvVar: `DECKHAND_ADDRESS`,
 		},
+		cli.StringFlag{
+			Name:   `virtual, V`,
+			Usage:  `Run against a simulated device of the given model (e.g.: mini, xl, plus) instead of one attached via USB.`,
+			EnvVar: `DECKHAND_VIRTUAL`,
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
 		log.SetLevelString(c.String(`log-level`))
+		DeckhandDir = c.String(`config-root`)
 		return nil
 	}
 
+	app.Commands = []cli.Command{
+		{
+			Name:      `validate`,
+			Usage:     `Check deck configuration files for errors.`,
+			ArgsUsage: `[FILE ..]`,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  `model, m`,
+					Usage: `Check button and dial indices against the given device model (e.g.: mini, xl, plus).`,
+				},
+			},
+			Action: func(c *cli.Context) {
+				var filenames = c.Args()
+				var model *Model
+				var failed bool
+
+				if v := c.String(`model`); v != `` {
+					if model = ModelByName(v); model == nil {
+						log.Fatalf("unknown device model %q", v)
+					}
+				}
+
+				if len(filenames) == 0 {
+					if matches, err := filepath.Glob(filepath.Join(fileutil.MustExpandUser(DeckhandDir), `*`, `deck.yaml`)); err == nil {
+						filenames = matches
+					} else {
+						log.Fatal(err)
+					}
+				}
+
+				for _, filename := range filenames {
+					// type errors are reported by the validator, with more detail
+					if deck, err := LoadDeck(filename); isValidatable(err) {
+						if errs, err := deck.Validate(model); err == nil {
+							for _, cerr := range errs {
+								fmt.Println(cerr)
+								failed = true
+							}
+						} else {
+							fmt.Printf("%s: %v\n", filename, err)
+							failed = true
+						}
+					} else {
+						fmt.Printf("%s: %v\n", filename, err)
+						failed = true
+					}
+				}
+
+				if failed {
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:  `schema`,
+			Usage: `Print a JSON Schema describing deck.yaml, for use with editors that support them.`,
+			Action: func(c *cli.Context) {
+				var enc = json.NewEncoder(os.Stdout)
+
+				enc.SetIndent(``, `  `)
+				enc.SetEscapeHTML(false)
+
+				log.FatalIf(enc.Encode(DeckSchema()))
+			},
+		},
+	}
+
 	app.Action = func(c *cli.Context) {
-		DeckhandDir = c.String(`config-root`)
+		var devices []Device
+		var err error
 
-		var deck, err = OpenDeck(filepath.Join(DeckhandDir, `default`, `deck.yaml`))
-		log.FatalIf(err)
-		defer deck.Close()
+		if v := c.String(`virtual`); v != `` {
+			if model := ModelByName(v); model != nil {
+				devices = append(devices, NewVirtualDevice(model, `virtual`))
+			} else {
+				err = fmt.Errorf("unknown device model %q", v)
+			}
+		} else {
+			devices, err = OpenUSBDevices()
+		}
 
-		log.Infof("loaded deck %v", deck.Filename())
+		log.FatalIf(err)
 
-		go func() {
-			log.FatalIf(deck.ListenAndServe(c.String(`address`)))
-		}()
+		var deckhand = NewDeckhand()
+		defer deckhand.Close()
 
-		deck.Page = c.String(`page`)
+		for _, device := range devices {
+			var deck, err = LoadDeck(DeckConfigPath(device.Serial()))
+			log.FatalIf(err)
 
-		for range time.NewTicker(125 * time.Millisecond).C {
-			if err := deck.Render(); err != nil {
-				log.Warning(err)
+			// the page is chosen before attaching, so that the deck starts out on it (and runs its onEnter
+			// actions, helpers, etc.) rather than entering the default page first
+			if page := c.String(`page`); page != `` {
+				deck.Page = page
+				deck.Home = page
 			}
+
+			log.FatalIf(deck.Attach(device))
+			log.Infof("loaded deck %v (%s, serial %q) from %v", deck.Name, device.Model().Name, deck.Serial, deck.Filename())
+
+			deckhand.Add(deck)
+
+			go deck.Run(125 * time.Millisecond)
 		}
+
+		log.FatalIf(deckhand.ListenAndServe(c.String(`address`)))
 	}
 
 	app.Run(os.Args)
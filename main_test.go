@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// write the given files (keyed on their paths, relative to a new temporary directory) and return the
+// directory they were written to.
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var root = t.TempDir()
+
+	for name, content := range files {
+		var filename = filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+// load the given deck configuration as the default deck, and attach it to a virtual device.
+func newTestDeck(t *testing.T, config string) *Deck {
+	t.Helper()
+
+	var dir = DeckhandDir
+
+	DeckhandDir = writeTestFiles(t, map[string]string{
+		`default/deck.yaml`: config,
+	})
+
+	t.Cleanup(func() {
+		DeckhandDir = dir
+	})
+
+	var deck, err = AttachDeck(NewVirtualDevice(ModelByName(`mini`), `virtual`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		deck.Close()
+	})
+
+	return deck
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"sync"
+)
+
+// A Frame is a rendered image that was most recently sent to one of a deck's keys, or its touch strip.
+type Frame struct {
+	Key   int    `json:"key"`
+	Strip bool   `json:"strip,omitempty"`
+	Image string `json:"image"`
+	img   image.Image
+}
+
+// frameMirror keeps a copy of whatever is currently displayed on a deck, and notifies
+// subscribers (e.g.: the browser-based virtual deck) whenever a key's image changes.
+type frameMirror struct {
+	frames      map[int]*Frame
+	subscribers map[chan *Frame]bool
+	lock        sync.Mutex
+}
+
+// records the image being sent to a key (or the touch strip when strip is true), and
+// publishes it to any subscribers if it differs from the previous image.
+func (self *frameMirror) publish(key int, strip bool, img image.Image) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.frames == nil {
+		self.frames = make(map[int]*Frame)
+	}
+
+	var id = key
+
+	if strip {
+		id = -1
+	}
+
+	if last, ok := self.frames[id]; ok && sameImage(last.img, img) {
+		return
+	}
+
+	var frame = &Frame{
+		Key:   key,
+		Strip: strip,
+		img:   img,
+	}
+
+	self.frames[id] = frame
+
+	if len(self.subscribers) > 0 {
+		frame.encode()
+
+		for sub := range self.subscribers {
+			select {
+			case sub <- frame:
+			default:
+			}
+		}
+	}
+}
+
+// Return a channel that receives every frame that is displayed from now on, along with a
+// function that must be called to stop receiving them.  All frames currently on display are
+// sent to the channel immediately.
+func (self *frameMirror) Subscribe() (<-chan *Frame, func()) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.subscribers == nil {
+		self.subscribers = make(map[chan *Frame]bool)
+	}
+
+	var sub = make(chan *Frame, len(self.frames)+64)
+
+	for _, frame := range self.frames {
+		frame.encode()
+		sub <- frame
+	}
+
+	self.subscribers[sub] = true
+
+	return sub, func() {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		delete(self.subscribers, sub)
+	}
+}
+
+func (self *Frame) encode() {
+	if self.Image != `` || self.img == nil {
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, self.img); err == nil {
+		self.Image = `data:image/png;base64,` + base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+}
+
+func sameImage(a image.Image, b image.Image) bool {
+	if ra, ok := a.(*image.RGBA); ok {
+		if rb, ok := b.(*image.RGBA); ok {
+			return ra.Rect.Eq(rb.Rect) && bytes.Equal(ra.Pix, rb.Pix)
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+)
+
+// ElgatoVendorID is the USB vendor ID shared by all Stream Deck devices.
+const ElgatoVendorID = 0x0fd9
+
+type ImageEncoding string
+
+const (
+	EncodingJPEG ImageEncoding = `jpeg`
+	EncodingBMP  ImageEncoding = `bmp`
+)
+
+// A Model describes the physical layout of a member of the Stream Deck family, as well as
+// the details needed to draw on and communicate with its keys.  Gap is the approximate space
+// between adjacent keys, measured in key pixels, and is used to line up images that span several keys.
+type Model struct {
+	Name       string        `json:"name"`
+	ProductIDs []uint16      `json:"-"`
+	Rows       int           `json:"rows"`
+	Cols       int           `json:"cols"`
+	KeySize    int           `json:"keySize"`
+	Gap        int           `json:"gap"`
+	Rotation   int           `json:"rotation"`
+	FlipX      bool          `json:"flipX"`
+	FlipY      bool          `json:"flipY"`
+	Encoding   ImageEncoding `json:"encoding"`
+	Dials      int           `json:"dials,omitempty"`
+	StripW     int           `json:"stripWidth,omitempty"`
+	StripH     int           `json:"stripHeight,omitempty"`
+	generation int
+	legacy     bool
+}
+
+// Models is the registry of all known Stream Deck devices.
+var Models = []*Model{
+	{
+		Name:       `Stream Deck Mini`,
+		ProductIDs: []uint16{0x0063, 0x0090},
+		Rows:       2,
+		Cols:       3,
+		KeySize:    80,
+		Gap:        20,
+		Rotation:   90,
+		FlipY:      true,
+		Encoding:   EncodingBMP,
+		generation: 1,
+	}, {
+		Name:       `Stream Deck Original`,
+		ProductIDs: []uint16{0x0060},
+		Rows:       3,
+		Cols:       5,
+		KeySize:    72,
+		Gap:        16,
+		FlipX:      true,
+		FlipY:      true,
+		Encoding:   EncodingBMP,
+		generation: 1,
+		legacy:     true,
+	}, {
+		Name:       `Stream Deck Original V2`,
+		ProductIDs: []uint16{0x006d},
+		Rows:       3,
+		Cols:       5,
+		KeySize:    72,
+		Gap:        16,
+		FlipX:      true,
+		FlipY:      true,
+		Encoding:   EncodingJPEG,
+		generation: 2,
+	}, {
+		Name:       `Stream Deck MK.2`,
+		ProductIDs: []uint16{0x0080},
+		Rows:       3,
+		Cols:       5,
+		KeySize:    72,
+		Gap:        16,
+		FlipX:      true,
+		FlipY:      true,
+		Encoding:   EncodingJPEG,
+		generation: 2,
+	}, {
+		Name:       `Stream Deck XL`,
+		ProductIDs: []uint16{0x006c, 0x008f},
+		Rows:       4,
+		Cols:       8,
+		KeySize:    96,
+		Gap:        20,
+		FlipX:      true,
+		FlipY:      true,
+		Encoding:   EncodingJPEG,
+		generation: 2,
+	}, {
+		Name:       `Stream Deck Plus`,
+		ProductIDs: []uint16{0x0084},
+		Rows:       2,
+		Cols:       4,
+		KeySize:    120,
+		Gap:        40,
+		Encoding:   EncodingJPEG,
+		Dials:      4,
+		StripW:     800,
+		StripH:     100,
+		generation: 2,
+	}, {
+		Name:       `Stream Deck Neo`,
+		ProductIDs: []uint16{0x009a},
+		Rows:       2,
+		Cols:       4,
+		KeySize:    96,
+		Gap:        24,
+		FlipX:      true,
+		FlipY:      true,
+		Encoding:   EncodingJPEG,
+		generation: 2,
+	},
+}
+
+// The model that is assumed when no other information is available.
+var DefaultModel = ModelByName(`original v2`)
+
+// Retrieve a model by its name.  Matching is case-insensitive, and the "Stream Deck" prefix
+// may be omitted (e.g.: "xl", "mini", "Stream Deck MK.2").
+func ModelByName(name string) *Model {
+	name = strings.TrimSpace(strings.ToLower(name))
+	name = strings.TrimPrefix(name, `stream deck `)
+
+	for _, model := range Models {
+		if strings.TrimPrefix(strings.ToLower(model.Name), `stream deck `) == name {
+			return model
+		}
+	}
+
+	return nil
+}
+
+// Retrieve a model by its USB product ID.
+func ModelByProductID(pid uint16) *Model {
+	for _, model := range Models {
+		for _, id := range model.ProductIDs {
+			if id == pid {
+				return model
+			}
+		}
+	}
+
+	return nil
+}
+
+// Return the total number of keys on the device.
+func (self *Model) Keys() int {
+	return self.Rows * self.Cols
+}
+
+// Return whether the device has a touch strip display.
+func (self *Model) HasStrip() bool {
+	return self.StripW > 0 && self.StripH > 0
+}
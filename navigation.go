@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// The most pages that are remembered for the "back" action.  Older pages are forgotten first.
+var MaxHistory = 64
+
+// Switch to the named page, remembering the current one so that the "back" action can return to it.
+// This is what the "page:NAME" action does; "replace:NAME" uses SetPage instead, which leaves the
+// history as it is.
+func (self *Deck) PushPage(name string) error {
+	var current = self.currentPageName()
+
+	self.navLock.Lock()
+
+	if current != `` && current != name {
+		self.history = append(self.history, current)
+
+		if len(self.history) > MaxHistory {
+			self.history = self.history[len(self.history)-MaxHistory:]
+		}
+	}
+
+	self.navLock.Unlock()
+
+	return self.SetPage(name)
+}
+
+// Return to the page that was showing before the last call to PushPage.  Pages that no longer exist
+// (because they were removed from the configuration) are skipped.  Does nothing if there is no history.
+func (self *Deck) Back() error {
+	self.navLock.Lock()
+
+	for len(self.history) > 0 {
+		var name = self.history[len(self.history)-1]
+
+		self.history = self.history[:len(self.history)-1]
+
+		if _, ok := self.Pages[name]; ok {
+			self.navLock.Unlock()
+			return self.SetPage(name)
+		}
+	}
+
+	self.navLock.Unlock()
+
+	return nil
+}
+
+// Return to the deck's home page, and forget the navigation history.
+func (self *Deck) GoHome() error {
+	self.navLock.Lock()
+	self.history = nil
+	self.navLock.Unlock()
+
+	return self.SetPage(self.Home)
+}
+
+// the name of the page that is showing, which is "default" if no page was set.
+func (self *Deck) currentPageName() string {
+	if pg := self.CurrentPage(); pg != nil {
+		return pg.Name
+	}
+
+	return self.Page
+}
+
+// Return the pages that the "back" action would return to, from the oldest to the most recent.
+func (self *Deck) History() []string {
+	self.navLock.Lock()
+	defer self.navLock.Unlock()
+
+	var history = make([]string, len(self.history))
+	copy(history, self.history)
+
+	return history
+}
+
+// describes where the deck is in its navigation history; exposed to templates and helpers as "navigation".
+func (self *Deck) navigation() map[string]interface{} {
+	var history = self.History()
+
+	return map[string]interface{}{
+		`page`:    self.currentPageName(),
+		`home`:    self.Home,
+		`history`: history,
+		`depth`:   len(history),
+	}
+}
+
+func (self *Deck) MarshalJSON() ([]byte, error) {
+	type Alias Deck
+
+	var history = self.History()
+
+	return json.Marshal(&struct {
+		*Alias
+		History []string
+		Depth   int
+	}{
+		Alias:   (*Alias)(self),
+		History: history,
+		Depth:   len(history),
+	})
+}
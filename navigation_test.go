@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBackFromDefaultPage(t *testing.T) {
+	var deck = newTestDeck(t, `pages:
+  default:
+    buttons:
+      1: {text: one}
+  other:
+    buttons:
+      1: {text: two}
+`)
+
+	// as when no --page is given, which leaves the deck on the default page without naming it
+	deck.Page = ``
+	deck.Home = ``
+
+	if name := deck.CurrentPage().Name; name != `default` {
+		t.Fatalf("expected to start on the default page, got %q", name)
+	}
+
+	if err := deck.PushPage(`other`); err != nil {
+		t.Fatal(err)
+	} else if name := deck.CurrentPage().Name; name != `other` {
+		t.Fatalf("expected to be on page other, got %q", name)
+	} else if history := deck.History(); !reflect.DeepEqual(history, []string{`default`}) {
+		t.Fatalf("expected the default page to be in the history, got %v", history)
+	}
+
+	if err := deck.Back(); err != nil {
+		t.Fatal(err)
+	} else if name := deck.CurrentPage().Name; name != `default` {
+		t.Fatalf("expected back to return to the default page, got %q", name)
+	} else if history := deck.History(); len(history) != 0 {
+		t.Fatalf("expected the history to be empty, got %v", history)
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go/constant"
 	"go/token"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghetzel/deckhand/clutch"
@@ -23,18 +28,45 @@ type pageSetDataFunc func(m *maputil.Map, key string, value string) interface{}
 
 type Page struct {
 	Name         string          `yaml:"-"`
+	Extends      string          `yaml:"extends"`
 	DataSources  clutch.Store    `yaml:"data"`
 	Buttons      map[int]*Button `yaml:"buttons"`
 	Defaults     *Button         `yaml:"defaults"`
 	Helper       string          `yaml:"helper"`
 	HelperArgs   string          `yaml:"helperArgs"`
 	Refresh      string          `yaml:"refresh"`
+	Dials        map[int]*Dial   `yaml:"dials"`
+	Strip        *Button         `yaml:"strip"`
+	OnTouch      string          `yaml:"onTouch"`
+	OnLongTouch  string          `yaml:"onLongTouch"`
+	OnSwipeLeft  string          `yaml:"onSwipeLeft"`
+	OnSwipeRight string          `yaml:"onSwipeRight"`
+	OnEnter      string          `yaml:"onEnter"`
+	OnExit       string          `yaml:"onExit"`
+	OnIdle       string          `yaml:"onIdle"`
+	IdleTimeout  string          `yaml:"idleTimeout"`
+	Wallpaper    string          `yaml:"wallpaper"`
+	WallpaperGap *int            `yaml:"wallpaperGap"`
+	Pagination   *Pagination     `yaml:"pagination"`
 	deck         *Deck
 	everHelped   bool
 	everSynced   bool
 	lastSyncedAt time.Time
 	data         *maputil.Map
+	helperLock   sync.Mutex
 	helpRunning  bool
+	helperQueued bool
+	helperCancel context.CancelFunc
+	helperErr    error
+	lastHelpedAt time.Time
+	wallpaper    *wallpaper
+	screen       int
+	screenLayout *pageLayout
+	prevButton   *Button
+	nextButton   *Button
+	fillers      map[int]*Button
+	stream       *helperStream
+	streamLock   sync.Mutex
 }
 
 func init() {
@@ -49,7 +81,7 @@ func (self *Page) Render() error {
 			btn.sticky = true
 		}
 
-		if err := self.RunHelper(); err != nil {
+		if err := self.runHelper(true); err != nil {
 			log.Warningf("helper %v: %v", self.Helper, err)
 		}
 
@@ -57,7 +89,7 @@ func (self *Page) Render() error {
 	}
 
 	if !self.everSynced || self.shouldSync() {
-		if err := self.Sync(); err != nil {
+		if err := self.sync(true); err != nil {
 			return err
 		}
 
@@ -67,7 +99,16 @@ func (self *Page) Render() error {
 	for i, btn := range self.Buttons {
 		btn.page = self
 		btn.Index = i
-		log.AppendError(merr, btn.Render())
+	}
+
+	for key := 1; key <= self.deck.Count; key++ {
+		if btn := self.buttonForKey(key); btn != nil {
+			merr = log.AppendError(merr, btn.Render())
+		}
+	}
+
+	if strip := self.strip(); strip != nil {
+		merr = log.AppendError(merr, strip.Render())
 	}
 
 	return merr
@@ -82,6 +123,15 @@ func (self *Page) shouldSync() bool {
 		}
 	}
 
+	if helper := self.helper(); helper != nil && helper.Mode != HelperStream {
+		if interval := typeutil.Duration(helper.Interval); interval > 0 {
+			self.helperLock.Lock()
+			defer self.helperLock.Unlock()
+
+			return !self.helpRunning && time.Since(self.lastHelpedAt) > interval
+		}
+	}
+
 	return false
 }
 
@@ -101,146 +151,370 @@ func (self *Page) syncData() error {
 	return nil
 }
 
+// Run the page's helper and apply its output to the page.  What happens if the helper is already running
+// depends on its overlap setting (see Helper).
 func (self *Page) RunHelper() error {
-	if self.Helper != `` {
-		if self.helpRunning {
+	return self.runHelper(false)
+}
+
+// run the page's helper.  The helper's output is applied to the page while holding the deck's render lock,
+// which the caller may already hold (i.e.: because it is rendering).
+func (self *Page) runHelper(locked bool) error {
+	var helper = self.helper()
+
+	if helper == nil {
+		return nil
+	} else if helper.Mode == HelperStream {
+		self.startHelperStream(helper)
+		return nil
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	self.helperLock.Lock()
+
+	if self.helpRunning {
+		switch helper.Overlap {
+		case HelperQueue:
+			self.helperQueued = true
+			self.helperLock.Unlock()
+			return nil
+		case HelperCancel:
+			self.helperCancel()
+		default:
+			self.helperLock.Unlock()
+			return nil
+		}
+	}
+
+	self.helpRunning = true
+	self.helperCancel = cancel
+	self.helperLock.Unlock()
+
+	for {
+		var err = self.runHelperOnce(ctx, helper, locked)
+
+		self.helperLock.Lock()
+
+		// a newer run cancelled this one, and is now responsible for the page
+		if ctx.Err() != nil {
+			self.helperLock.Unlock()
+			return nil
+		}
+
+		self.helperErr = err
+		self.lastHelpedAt = time.Now()
+
+		if self.helperQueued {
+			self.helperQueued = false
+			self.helperLock.Unlock()
+			continue
+		}
+
+		self.helpRunning = false
+		self.helperCancel = nil
+		self.helperLock.Unlock()
+
+		return err
+	}
+}
+
+// run the helper once, applying its output to the page unless the run is cancelled first.
+func (self *Page) runHelperOnce(ctx context.Context, helper *Helper, locked bool) error {
+	var timeout = typeutil.Duration(helper.Timeout)
+	var start = time.Now()
+
+	if timeout <= 0 {
+		timeout = DefaultHelperTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var unlock = self.lockRender(locked)
+
+	if err := self.syncData(); err != nil {
+		unlock()
+		return err
+	}
+
+	var helperCmd, secrets, cleanup, err = self.helperCommand(helper)
+
+	unlock()
+
+	if err == nil {
+		defer cleanup()
+
+		var output bytes.Buffer
+		var exited = make(chan bool)
+		defer close(exited)
+
+		helperCmd.Stdout = &output
+
+		if helperCmd.InheritEnv {
+			helperCmd.Env = append(os.Environ(), helperCmd.Env...)
+		}
+
+		// as with streaming helpers, the process is started directly so that it can be killed while it is
+		// being waited on.  The whole process group is killed, since waiting on the helper also waits for
+		// everything that is holding on to its output to go, not just the helper itself.
+		setProcessGroup(helperCmd.Cmd)
+
+		if err := helperCmd.Cmd.Start(); err != nil {
+			return redact(err, secrets)
+		}
+
+		var proc = &helperProcess{
+			cmd: helperCmd.Cmd,
+		}
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				proc.kill()
+			case <-exited:
+			}
+		}()
+
+		var err = proc.wait()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %v", timeout)
+		} else if ctx.Err() != nil {
 			return nil
+		} else if err != nil {
+			return redact(err, secrets)
+		}
+
+		log.Debugf("helper %v: took %v", self.Helper, time.Since(start))
+
+		defer self.lockRender(locked)()
+
+		// the run may have been cancelled while waiting to apply its output
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		for _, line := range strings.Split(output.String(), "\n") {
+			self.applyHelperLine(line)
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+// take the deck's render lock, unless the caller already holds it, and return the function that releases it.
+func (self *Page) lockRender(locked bool) func() {
+	if locked {
+		return func() {}
+	}
+
+	self.deck.renderLock.Lock()
+	return self.deck.renderLock.Unlock
+}
+
+// return the helper the page uses, if it has one.
+func (self *Page) helper() *Helper {
+	if self.Helper == `` || self.deck == nil {
+		return nil
+	} else if helper := self.deck.Helpers[self.Helper]; helper != nil && helper.Script != `` {
+		return helper
+	}
+
+	return nil
+}
+
+// Return the error from the last time the page's helper ran, if it failed.
+func (self *Page) HelperError() error {
+	self.helperLock.Lock()
+	defer self.helperLock.Unlock()
+
+	return self.helperErr
+}
+
+func (self *Page) MarshalJSON() ([]byte, error) {
+	type Alias Page
+
+	var helperError string
+
+	if err := self.HelperError(); err != nil {
+		helperError = err.Error()
+	}
+
+	return json.Marshal(&struct {
+		*Alias
+		HelperError string
+	}{
+		Alias:       (*Alias)(self),
+		HelperError: helperError,
+	})
+}
+
+func (self *Page) setHelperError(err error) {
+	self.helperLock.Lock()
+	self.helperErr = err
+	self.helperLock.Unlock()
+}
+
+// prepare a command that runs the given helper for this page.  Along with the command, this returns the
+// secrets that were substituted into its arguments, and a function that removes the temporary files it
+// uses once it has finished.
+func (self *Page) helperCommand(helper *Helper) (*executil.Cmd, []string, func(), error) {
+	var helperTempPattern = fmt.Sprintf("deckhand-%s-%s-", self.deck.Name, self.Name)
+
+	// write helper data to a file
+	if datafile, err := fileutil.WriteTempFile(
+		maputil.M(self.dataMap()).JSON(`  `),
+		helperTempPattern+`data-`,
+	); err == nil {
+		os.Chmod(datafile, 0600)
+
+		// write helper script to a file
+		if tmp, err := fileutil.WriteTempFile(helper.Script, helperTempPattern); err == nil {
+			os.Chmod(tmp, 0700)
+
+			var cleanup = func() {
+				os.Remove(datafile)
+				os.Remove(tmp)
+			}
+
+			// var helperArgs []string
+
+			// if self.HelperArgs != `` {
+			// 	if args, err := executil.Split(self.HelperArgs); err == nil {
+			// 		helperArgs = args
+			// 	} else {
+			// 		return fmt.Errorf("bad args: %v", err)
+			// 	}
+			// }
+
+			var args, secrets, err = interpolateShell(self.HelperArgs)
+
+			if err != nil {
+				cleanup()
+				return nil, nil, nil, err
+			}
+
+			var helperCmd = executil.ShellCommand(tmp + ` ` + args)
+
+			self.prepCommand(helperCmd)
+
+			for i, v := range secrets {
+				helperCmd.SetEnv(shellValueVar(i), v)
+			}
+
+			helperCmd.Stderr = log.NewWritableLogger(log.WARNING, `helper: `)
+			helperCmd.SetEnv(`DIECAST_PAGE_DATA_FILE`, datafile)
+			helperCmd.SetEnv(`DECKHAND_DATA_FILE`, datafile)
+
+			return helperCmd, secrets, cleanup, nil
 		} else {
-			self.helpRunning = true
-			defer func() {
-				self.helpRunning = false
-			}()
+			os.Remove(datafile)
+			return nil, nil, nil, err
 		}
+	} else {
+		return nil, nil, nil, err
+	}
+}
+
+// apply a single line of helper output to the page, returning the buttons that it changed.
+func (self *Page) applyHelperLine(line string) []*Button {
+	var preserveExisting bool
+
+	line = strings.TrimSpace(line)
+
+	if line == `` || strings.HasPrefix(line, `#`) {
+		return nil
+	} else if strings.HasPrefix(line, `@`) {
+		var atDirective, rest = stringutil.SplitPair(
+			strings.TrimPrefix(line, `@`),
+			` `,
+		)
 
-		if helper, ok := self.deck.Helpers[self.Helper]; ok && helper != `` {
-			if err := self.syncData(); err != nil {
-				return err
+		atDirective = strings.ToLower(atDirective)
+
+		switch atDirective {
+		case `clear`:
+			self.Clear()
+
+			var cleared = make([]*Button, 0, len(self.Buttons))
+
+			for _, btn := range self.Buttons {
+				cleared = append(cleared, btn)
 			}
 
-			var helperTempPattern = fmt.Sprintf("deckhand-%s-%s-", self.deck.Name, self.Name)
-			var start = time.Now()
-
-			// write helper data to a file
-			if datafile, err := fileutil.WriteTempFile(
-				maputil.M(self.dataMap()).JSON(`  `),
-				helperTempPattern+`data-`,
-			); err == nil {
-				os.Chmod(datafile, 0600)
-				defer os.Remove(datafile)
-
-				// write helper script to a file
-				if tmp, err := fileutil.WriteTempFile(helper, helperTempPattern); err == nil {
-					os.Chmod(tmp, 0700)
-					defer os.Remove(tmp)
-
-					// var helperArgs []string
-
-					// if self.HelperArgs != `` {
-					// 	if args, err := executil.Split(self.HelperArgs); err == nil {
-					// 		helperArgs = args
-					// 	} else {
-					// 		return fmt.Errorf("bad args: %v", err)
-					// 	}
-					// }
-
-					var helperCmd = executil.ShellCommand(tmp + ` ` + self.HelperArgs)
-
-					self.prepCommand(helperCmd)
-
-					helperCmd.Timeout = time.Second
-					helperCmd.Stderr = log.NewWritableLogger(log.WARNING, `helper: `)
-					helperCmd.SetEnv(`DIECAST_PAGE_DATA_FILE`, datafile)
-					helperCmd.SetEnv(`DECKHAND_DATA_FILE`, datafile)
-
-					if btn, err := helperCmd.Output(); err == nil {
-						log.Debugf("helper %v: took %v", self.Helper, time.Since(start))
-
-						for _, line := range strings.Split(string(btn), "\n") {
-							var preserveExisting bool
-
-							line = strings.TrimSpace(line)
-
-							if line == `` || strings.HasPrefix(line, `#`) {
-								continue
-							} else if strings.HasPrefix(line, `@`) {
-								var atDirective, rest = stringutil.SplitPair(
-									strings.TrimPrefix(line, `@`),
-									` `,
-								)
-
-								atDirective = strings.ToLower(atDirective)
-
-								switch atDirective {
-								case `clear`:
-									self.Clear()
-								case `preserve`:
-									preserveExisting = true
-								case `debug`:
-									if len(rest) > 0 {
-										log.Debugf("HELPER-DEBUG[%s]: %s", self.Helper, rest)
-									} else {
-										log.Debugf("HELPER-DEBUG[%s]", self.Helper)
-									}
-								}
-
-								continue
-							}
-
-							if k, v := stringutil.SplitPairTrimSpace(line, `=`); k != `` {
-								var bkey = strings.Split(k, `.`)
-								var bidx int = int(typeutil.Int(bkey[0]))
-								var btn *Button
-								var wasThere bool
-
-								if b, ok := self.Buttons[bidx]; ok {
-									btn = b
-									wasThere = true
-								} else {
-									btn = NewButton(self, bidx)
-									btn.auto = true
-								}
-
-								defaults.SetDefaults(btn)
-								btn.page = self
-								self.Buttons[bidx] = btn
-
-								if wasThere && preserveExisting {
-									continue
-								}
-
-								if btn != nil {
-									// this wild nonsense lets us piggypack on golang's own string escaping rules
-									v = constant.StringVal(
-										constant.MakeFromLiteral(
-											`"`+v+`"`,
-											token.STRING,
-											0,
-										),
-									)
-
-									btn.SetProperty(
-										strings.Join(bkey[1:], `.`),
-										typeutil.Auto(v),
-									)
-								}
-							}
-						}
-					} else {
-						return err
-					}
-				} else {
-					return err
-				}
+			return cleared
+		case `preserve`:
+			preserveExisting = true
+		case `debug`:
+			if len(rest) > 0 {
+				log.Debugf("HELPER-DEBUG[%s]: %s", self.Helper, rest)
 			} else {
-				return err
+				log.Debugf("HELPER-DEBUG[%s]", self.Helper)
 			}
 		}
+
+		return nil
+	}
+
+	if k, v := stringutil.SplitPairTrimSpace(line, `=`); k != `` {
+		var bkey = strings.Split(k, `.`)
+		var bidx int = int(typeutil.Int(bkey[0]))
+		var btn *Button
+		var wasThere bool
+
+		if b, ok := self.Buttons[bidx]; ok {
+			btn = b
+			wasThere = true
+		} else {
+			btn = NewButton(self, bidx)
+			btn.auto = true
+			self.relayout()
+		}
+
+		defaults.SetDefaults(btn)
+		btn.page = self
+		self.Buttons[bidx] = btn
+
+		if wasThere && preserveExisting {
+			return nil
+		}
+
+		if btn != nil {
+			// this wild nonsense lets us piggypack on golang's own string escaping rules
+			v = constant.StringVal(
+				constant.MakeFromLiteral(
+					`"`+v+`"`,
+					token.STRING,
+					0,
+				),
+			)
+
+			btn.SetProperty(
+				strings.Join(bkey[1:], `.`),
+				typeutil.Auto(v),
+			)
+
+			return []*Button{btn}
+		}
 	}
 
 	return nil
 }
 
 func (self *Page) Clear() error {
+	// buttons past the last key only exist on later screens, so they are removed rather than blanked
+	for i, btn := range self.Buttons {
+		if i > self.deck.Count && !btn.sticky {
+			delete(self.Buttons, i)
+		}
+	}
+
+	self.relayout()
+
 	for i := 1; i <= self.deck.Count; i++ {
 		if btn, ok := self.Buttons[i]; ok && btn.sticky {
 			continue
@@ -256,12 +530,19 @@ func (self *Page) Clear() error {
 }
 
 func (self *Page) Sync() error {
+	return self.sync(false)
+}
+
+// sync the page, where locked is whether the caller already holds the deck's render lock.
+func (self *Page) sync(locked bool) error {
 	if self.deck == nil {
 		return fmt.Errorf("cannot sync page: no deck specified")
 	} else if len(self.Buttons) == 0 {
 		self.Buttons = make(map[int]*Button)
 	}
 
+	self.relayout()
+
 	if self.lastSyncedAt.IsZero() {
 		self.syncData()
 	}
@@ -270,7 +551,7 @@ func (self *Page) Sync() error {
 		return fmt.Errorf("page %v: %v", self.Name, err)
 	}
 
-	if err := self.RunHelper(); err != nil {
+	if err := self.runHelper(locked); err != nil {
 		log.Warningf("helper %v: %v", self.Helper, err)
 	}
 
@@ -288,15 +569,68 @@ func (self *Page) Sync() error {
 		self.Buttons[i].Sync()
 	}
 
+	// buttons on other screens
+	for i, btn := range self.Buttons {
+		if i > self.deck.Count {
+			btn.page = self
+			btn.Index = i
+			btn.Sync()
+		}
+	}
+
+	// as are the keys used to move between screens
+	for _, btn := range []*Button{self.prevButton, self.nextButton} {
+		if btn != nil {
+			btn.Sync()
+		}
+	}
+
+	for _, btn := range self.fillers {
+		btn.Sync()
+	}
+
+	if strip := self.strip(); strip != nil {
+		strip.Sync()
+	}
+
 	self.lastSyncedAt = time.Now()
 	return nil
 }
 
-func (self *Page) trigger(i int) error {
-	if btn, ok := self.Buttons[i]; ok {
-		return btn.Trigger()
-	} else {
-		return nil
+// return the button used to draw the touch strip, if this page has one and the device supports it.
+func (self *Page) strip() *Button {
+	if self.Strip != nil && self.deck.model().HasStrip() {
+		self.Strip.page = self
+		self.Strip.strip = true
+
+		return self.Strip
+	}
+
+	return nil
+}
+
+// Run a set of actions that are not attached to any particular button (e.g.: dial and touch strip
+// input).  Templates in the actions are evaluated against the page data first.
+func (self *Page) runActions(actions string) error {
+	if strings.Contains(actions, `{{`) && strings.Contains(actions, `}}`) {
+		if out, err := self.eval(actions); err == nil {
+			actions = out.String()
+		} else {
+			return err
+		}
+	}
+
+	return NewButton(self, 0).runActions(actions)
+}
+
+// run a list of actions that the page is notified of (e.g.: onEnter, onExit, onIdle), if there are any.
+func (self *Page) runHook(name string, actions string) {
+	if actions == `` {
+		return
+	}
+
+	if err := self.runActions(actions); err != nil {
+		log.Warningf("page %v: %s: %v", self.Name, name, err)
 	}
 }
 
@@ -340,10 +674,11 @@ func (self *Page) prepCommand(cmd *executil.Cmd) {
 
 	cmd.SetEnv(`DECKHAND_PAGE`, self.Name)
 	cmd.SetEnv(`DECKHAND_DECK`, self.deck.Name)
+	cmd.SetEnv(`DECKHAND_DEVICE_SERIAL`, self.deck.Serial)
 	cmd.SetEnv(`DECKHAND_DEVICE_BUTTONS`, self.deck.Count)
 	cmd.SetEnv(`DECKHAND_DEVICE_ROWS`, self.deck.Rows)
 	cmd.SetEnv(`DECKHAND_DEVICE_COLS`, self.deck.Cols)
-	cmd.SetEnv(`DECKHAND_DEVICE_MODEL`, self.deck.device.GetName())
+	cmd.SetEnv(`DECKHAND_DEVICE_MODEL`, self.deck.Model.Name)
 }
 
 func (self *Page) setDataFromArgLine(arg string, valfn pageSetDataFunc) {
@@ -370,5 +705,85 @@ func (self *Page) dataMap() map[string]interface{} {
 		self.data = maputil.M(nil)
 	}
 
-	return self.data.MapNative()
+	var data = self.data.MapNative()
+
+	if self.deck != nil {
+		var layout = self.layout()
+
+		data[`navigation`] = self.deck.navigation()
+		data[`pageIndex`] = layout.screen + 1
+		data[`pageCount`] = layout.screens
+	}
+
+	if err := self.HelperError(); err != nil {
+		data[`helperError`] = err.Error()
+	} else {
+		data[`helperError`] = ``
+	}
+
+	return data
+}
+
+// Pages can extend another page, inheriting all of its settings (buttons, defaults, data sources,
+// helper, refresh interval, etc.) and overriding only the ones they specify.  Buttons are merged
+// property-by-property, so a page can (for example) change just the text of an inherited button.
+// The page being extended may itself extend another page.
+//
+// This resolves the "extends" setting of every page in a config document, in place.
+func resolvePageExtends(doc map[interface{}]interface{}) error {
+	var pages, ok = doc[`pages`].(map[interface{}]interface{})
+
+	if !ok {
+		return nil
+	}
+
+	var resolved = make(map[interface{}]map[interface{}]interface{})
+	var resolve func(name interface{}, chain []string) (map[interface{}]interface{}, error)
+
+	resolve = func(name interface{}, chain []string) (map[interface{}]interface{}, error) {
+		if page, ok := resolved[name]; ok {
+			return page, nil
+		}
+
+		chain = append(chain, fmt.Sprintf("%v", name))
+
+		for _, seen := range chain[:len(chain)-1] {
+			if seen == chain[len(chain)-1] {
+				return nil, fmt.Errorf("page %v: extends cycle: %s", chain[0], strings.Join(chain, ` -> `))
+			}
+		}
+
+		var page, _ = pages[name].(map[interface{}]interface{})
+
+		if page == nil {
+			page = make(map[interface{}]interface{})
+		}
+
+		if parent, ok := page[`extends`]; ok && parent != nil {
+			var pname = fmt.Sprintf("%v", parent)
+
+			if _, ok := pages[pname]; !ok {
+				return nil, fmt.Errorf("page %v: cannot extend page %q: no such page", name, pname)
+			}
+
+			if base, err := resolve(pname, chain); err == nil {
+				page = mergeConfig(base, page)
+			} else {
+				return nil, err
+			}
+		}
+
+		resolved[name] = page
+		return page, nil
+	}
+
+	for name := range pages {
+		if page, err := resolve(name, nil); err == nil {
+			pages[name] = page
+		} else {
+			return err
+		}
+	}
+
+	return nil
 }
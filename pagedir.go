@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+// The name of the page directory whose keys are shared by every page.
+const SharedPageDir = `_`
+
+// Pages and buttons can also be configured using a tree of plain files that lives alongside deck.yaml.
+// This allows scripts to update individual keys (e.g.: "echo red > pages/default/03/fill"), and the
+// changes are picked up immediately.
+//
+//	pages/
+//	  {_,[PAGENAME]}/
+//	    {00,01,02...14}/
+//	      fill
+//	      image
+//	      color
+//	      text
+//
+// Key directories are numbered from 00 (the top-left key).  Each file inside of them sets the button
+// property of the same name (any property that a helper can set is supported), using the file's contents
+// as the value.  The "image" file may either contain the path to an image, or be an image itself.
+//
+// Keys under the "_" directory appear on every page.  Values from this tree take precedence over those
+// in deck.yaml, and values for a specific page take precedence over those in "_".
+func (self *Deck) loadPageDir() error {
+	var root = self.path(`pages`)
+
+	if !fileutil.DirExists(root) {
+		return nil
+	}
+
+	var entries, err = os.ReadDir(root)
+
+	if err != nil {
+		return err
+	}
+
+	var shared map[int]map[string]string
+	var pages = make(map[string]map[int]map[string]string)
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), `.`) {
+			continue
+		}
+
+		if keys, err := readKeyDirs(filepath.Join(root, entry.Name())); err == nil {
+			if entry.Name() == SharedPageDir {
+				shared = keys
+			} else {
+				pages[entry.Name()] = keys
+			}
+		} else {
+			return err
+		}
+	}
+
+	if self.Pages == nil {
+		self.Pages = make(map[string]*Page)
+	}
+
+	for name := range pages {
+		if _, ok := self.Pages[name]; !ok {
+			self.Pages[name] = new(Page)
+		}
+	}
+
+	for _, pg := range self.Pages {
+		pg.applyKeyDirs(shared)
+	}
+
+	for name, keys := range pages {
+		self.Pages[name].applyKeyDirs(keys)
+	}
+
+	return nil
+}
+
+// start watching the page directory for changes, if it exists and is not already being watched.
+func (self *Deck) watchPageDir() {
+	var root = self.path(`pages`)
+
+	if self.watcher == nil || !fileutil.DirExists(root) {
+		return
+	}
+
+	if _, ok := self.watcher.WatchedFiles()[root]; !ok {
+		if err := self.watcher.AddRecursive(root); err != nil {
+			log.Warningf("deck %v: cannot watch %v: %v", self.ID(), root, err)
+		}
+	}
+}
+
+// set button properties from a map of (1-based) key index -> property name -> value.
+func (self *Page) applyKeyDirs(keys map[int]map[string]string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	if self.Buttons == nil {
+		self.Buttons = make(map[int]*Button)
+	}
+
+	for i, properties := range keys {
+		var btn = self.Buttons[i]
+
+		if btn == nil {
+			btn = NewButton(self, i)
+			self.Buttons[i] = btn
+		}
+
+		for name, value := range properties {
+			btn.SetProperty(name, value)
+		}
+	}
+}
+
+// read all of the numbered key directories beneath the given page directory.
+func readKeyDirs(dir string) (map[int]map[string]string, error) {
+	var keys = make(map[int]map[string]string)
+	var entries, err = os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if n, err := strconv.Atoi(entry.Name()); err == nil && n >= 0 {
+			var keydir = filepath.Join(dir, entry.Name())
+			var files, err = os.ReadDir(keydir)
+
+			if err != nil {
+				return nil, err
+			}
+
+			var properties = make(map[string]string)
+
+			for _, file := range files {
+				var name = file.Name()
+
+				if file.IsDir() || strings.HasPrefix(name, `.`) || strings.HasSuffix(name, `~`) {
+					continue
+				}
+
+				var filename = filepath.Join(keydir, name)
+
+				if data, err := fileutil.ReadAll(filename); err == nil {
+					switch name {
+					case `text`:
+						properties[name] = strings.TrimRight(string(data), "\r\n")
+					case `image`:
+						if strings.HasPrefix(http.DetectContentType(data), `image/`) {
+							properties[name] = filename
+						} else {
+							properties[name] = strings.TrimSpace(string(data))
+						}
+					default:
+						properties[name] = strings.TrimSpace(string(data))
+					}
+				} else {
+					return nil, err
+				}
+			}
+
+			keys[n+1] = properties
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"github.com/mcuadros/go-defaults"
+)
+
+// Pages that have more buttons than the device has keys (whether from the config or from a helper) are
+// split across several screens.  Two keys on every screen are set aside for moving to the previous and
+// next screens (wrapping around at either end), and show which screen is currently being displayed.
+// The remaining keys show the page's buttons in order: on a 15-key device, buttons 1-13 are shown on
+// the first screen, buttons 14-26 on the second, and so on.
+//
+// By default, the last two keys are used for navigation.  This can be changed for the whole deck, or
+// for individual pages:
+//
+//	pagination:
+//	  prev: 11
+//	  next: 15
+//
+// Templates can refer to the current screen and the number of screens as "pageIndex" (starting from 1)
+// and "pageCount".  The "prev" and "next" actions can also be used by any button to change screens.
+type Pagination struct {
+	Prev int `yaml:"prev"`
+	Next int `yaml:"next"`
+}
+
+// how the buttons of a page are laid out across the keys of the device.
+type pageLayout struct {
+	slots   []int
+	prev    int
+	next    int
+	screen  int
+	screens int
+}
+
+// Return the layout of the page's buttons across the device's keys, as it currently stands.  This is
+// needed for every key on every render, so it is worked out once and kept until the page's buttons, its
+// pagination settings, or the screen being shown change.
+func (self *Page) layout() *pageLayout {
+	if self.screenLayout == nil {
+		self.screenLayout = self.arrange()
+	}
+
+	return self.screenLayout
+}
+
+// forget the page's layout, so that it is worked out again the next time it is needed.
+func (self *Page) relayout() {
+	self.screenLayout = nil
+}
+
+// work out the layout of the page's buttons across the device's keys.
+func (self *Page) arrange() *pageLayout {
+	var keys int
+	var last int
+
+	if self.deck != nil {
+		keys = self.deck.Count
+	}
+
+	for i := range self.Buttons {
+		if i > last {
+			last = i
+		}
+	}
+
+	var layout = &pageLayout{
+		screens: 1,
+	}
+
+	if last <= keys || keys < 3 {
+		for k := 1; k <= keys; k++ {
+			layout.slots = append(layout.slots, k)
+		}
+
+		return layout
+	}
+
+	var config = self.Pagination
+
+	if config == nil {
+		config = self.deck.Pagination
+	}
+
+	layout.prev = keys - 1
+	layout.next = keys
+
+	if config != nil {
+		if config.Prev >= 1 && config.Prev <= keys {
+			layout.prev = config.Prev
+		}
+
+		if config.Next >= 1 && config.Next <= keys && config.Next != layout.prev {
+			layout.next = config.Next
+		}
+
+		if layout.prev == layout.next {
+			layout.prev = keys - 1
+			layout.next = keys
+		}
+	}
+
+	for k := 1; k <= keys; k++ {
+		if k != layout.prev && k != layout.next {
+			layout.slots = append(layout.slots, k)
+		}
+	}
+
+	layout.screens = (last + len(layout.slots) - 1) / len(layout.slots)
+	layout.screen = self.screen
+
+	if layout.screen >= layout.screens {
+		layout.screen = layout.screens - 1
+	}
+
+	return layout
+}
+
+// Return the button being displayed on the given (1-based) key.
+func (self *Page) buttonForKey(key int) *Button {
+	var layout = self.layout()
+
+	switch key {
+	case 0:
+		return nil
+	case layout.prev:
+		return self.navButton(&self.prevButton, `prev`, "◀")
+	case layout.next:
+		return self.navButton(&self.nextButton, `next`, "▶")
+	}
+
+	for i, slot := range layout.slots {
+		if slot == key {
+			var index = (layout.screen * len(layout.slots)) + i + 1
+
+			if btn, ok := self.Buttons[index]; ok {
+				return btn
+			} else if layout.screens > 1 {
+				return self.filler(key)
+			} else {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// Return the (1-based) key that the given button is displayed on, or zero if it is not currently displayed.
+func (self *Page) keyOf(btn *Button) int {
+	var layout = self.layout()
+	var key int
+
+	switch {
+	case btn == nil:
+		return 0
+	case btn == self.prevButton:
+		key = layout.prev
+	case btn == self.nextButton:
+		key = layout.next
+	case btn.filler > 0:
+		key = btn.filler
+	case btn.Index > 0 && len(layout.slots) > 0:
+		if i := btn.Index - 1; i/len(layout.slots) == layout.screen {
+			key = layout.slots[i%len(layout.slots)]
+		}
+	}
+
+	if key > 0 && self.buttonForKey(key) == btn {
+		return key
+	}
+
+	return 0
+}
+
+// Move forwards or backwards by the given number of screens, wrapping around at either end.
+func (self *Page) turn(by int) {
+	var layout = self.layout()
+
+	self.screen = (((layout.screen + by) % layout.screens) + layout.screens) % layout.screens
+	self.relayout()
+
+	// every key is showing something different now, so everything needs to be redrawn
+	for _, btn := range self.Buttons {
+		btn.hasChanges = true
+	}
+
+	for _, btn := range self.fillers {
+		btn.hasChanges = true
+	}
+}
+
+// return one of the buttons used to move between screens, creating it if it doesn't exist yet.
+func (self *Page) navButton(btn **Button, action string, arrow string) *Button {
+	if *btn == nil {
+		*btn = NewButton(self, 0)
+		defaults.SetDefaults(*btn)
+		(*btn).auto = true
+		(*btn).Action = action
+		(*btn).Text = arrow + "\n{{ .pageIndex }}/{{ .pageCount }}"
+	}
+
+	return *btn
+}
+
+// return the blank button shown on keys that have nothing else to show (i.e.: at the end of the last screen).
+func (self *Page) filler(key int) *Button {
+	if self.fillers == nil {
+		self.fillers = make(map[int]*Button)
+	}
+
+	if _, ok := self.fillers[key]; !ok {
+		var btn = NewButton(self, 0)
+
+		defaults.SetDefaults(btn)
+		btn.auto = true
+		btn.filler = key
+		self.fillers[key] = btn
+	}
+
+	return self.fillers[key]
+}
+
+// Return the (1-based) key that the button is displayed on, or zero if it is not currently displayed.
+func (self *Button) key() int {
+	if self.page == nil || self.strip {
+		return 0
+	}
+
+	return self.page.keyOf(self)
+}
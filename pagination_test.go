@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// describe what each key of the page is showing: a button's index, "<" and ">" for the keys that move
+// between screens, "-" for blank keys at the end of the last screen, and "" for keys showing nothing.
+func describeKeys(page *Page) []string {
+	var keys []string
+
+	for key := 1; key <= page.deck.Count; key++ {
+		switch btn := page.buttonForKey(key); {
+		case btn == nil:
+			keys = append(keys, ``)
+		case btn == page.prevButton:
+			keys = append(keys, `<`)
+		case btn == page.nextButton:
+			keys = append(keys, `>`)
+		case btn.filler > 0:
+			keys = append(keys, `-`)
+		default:
+			keys = append(keys, fmt.Sprintf("%d", btn.Index))
+		}
+	}
+
+	return keys
+}
+
+func newTestPage(keys int, buttons []int, pagination *Pagination) *Page {
+	var page = &Page{
+		deck:       &Deck{Count: keys},
+		Buttons:    make(map[int]*Button),
+		Pagination: pagination,
+	}
+
+	for _, i := range buttons {
+		page.Buttons[i] = NewButton(page, i)
+	}
+
+	return page
+}
+
+func TestPageLayout(t *testing.T) {
+	var tests = []struct {
+		name       string
+		keys       int
+		buttons    []int
+		pagination *Pagination
+		screen     int
+		screens    int
+		shows      []string
+	}{
+		{
+			name:    `fewer buttons than keys`,
+			keys:    6,
+			buttons: []int{1, 2, 4},
+			screens: 1,
+			shows:   []string{`1`, `2`, ``, `4`, ``, ``},
+		}, {
+			name:    `as many buttons as keys`,
+			keys:    6,
+			buttons: []int{1, 2, 3, 4, 5, 6},
+			screens: 1,
+			shows:   []string{`1`, `2`, `3`, `4`, `5`, `6`},
+		}, {
+			name:    `one too many`,
+			keys:    6,
+			buttons: []int{1, 2, 3, 4, 5, 6, 7},
+			screens: 2,
+			shows:   []string{`1`, `2`, `3`, `4`, `<`, `>`},
+		}, {
+			name:    `second screen`,
+			keys:    6,
+			buttons: []int{1, 2, 3, 4, 5, 6, 7},
+			screen:  1,
+			screens: 2,
+			shows:   []string{`5`, `6`, `7`, `-`, `<`, `>`},
+		}, {
+			name:    `gaps`,
+			keys:    6,
+			buttons: []int{1, 10},
+			screen:  2,
+			screens: 3,
+			shows:   []string{`-`, `10`, `-`, `-`, `<`, `>`},
+		}, {
+			name:    `screen past the end`,
+			keys:    6,
+			buttons: []int{1, 9},
+			screen:  7,
+			screens: 3,
+			shows:   []string{`9`, `-`, `-`, `-`, `<`, `>`},
+		}, {
+			name:       `custom navigation keys`,
+			keys:       6,
+			buttons:    []int{1, 2, 3, 4, 5, 6, 7},
+			pagination: &Pagination{Prev: 1, Next: 4},
+			screens:    2,
+			shows:      []string{`<`, `1`, `2`, `>`, `3`, `4`},
+		}, {
+			name:       `navigation keys out of range`,
+			keys:       6,
+			buttons:    []int{1, 2, 3, 4, 5, 6, 7},
+			pagination: &Pagination{Prev: 0, Next: 9},
+			screens:    2,
+			shows:      []string{`1`, `2`, `3`, `4`, `<`, `>`},
+		}, {
+			name:       `navigation keys the same`,
+			keys:       6,
+			buttons:    []int{1, 2, 3, 4, 5, 6, 7},
+			pagination: &Pagination{Prev: 2, Next: 2},
+			screens:    2,
+			shows:      []string{`1`, `<`, `2`, `3`, `4`, `>`},
+		}, {
+			name:    `too few keys to paginate`,
+			keys:    2,
+			buttons: []int{1, 2, 3},
+			screens: 1,
+			shows:   []string{`1`, `2`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page = newTestPage(tt.keys, tt.buttons, tt.pagination)
+
+			page.screen = tt.screen
+
+			if layout := page.layout(); layout.screens != tt.screens {
+				t.Fatalf("expected %d screens, got %d", tt.screens, layout.screens)
+			} else if shows := describeKeys(page); !reflect.DeepEqual(shows, tt.shows) {
+				t.Fatalf("expected keys to show %q, got %q", tt.shows, shows)
+			}
+
+			// every button knows which key it is on (if any)
+			for _, i := range tt.buttons {
+				var btn = page.Buttons[i]
+				var want int
+
+				for k, shows := range tt.shows {
+					if shows == fmt.Sprintf("%d", i) {
+						want = k + 1
+					}
+				}
+
+				if key := page.keyOf(btn); key != want {
+					t.Fatalf("expected button %d to be on key %d, got %d", i, want, key)
+				}
+			}
+		})
+	}
+}
+
+func TestPageTurn(t *testing.T) {
+	var page = newTestPage(6, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, nil)
+	var screens = []int{0, 1, 2, 0}
+
+	for i, want := range screens {
+		if i > 0 {
+			page.turn(1)
+		}
+
+		if got := page.layout().screen; got != want {
+			t.Fatalf("turn %d: expected screen %d, got %d", i, want, got)
+		} else if key := page.keyOf(page.Buttons[(want*4)+1]); key != 1 {
+			t.Fatalf("turn %d: expected button %d on key 1, got %d", i, (want*4)+1, key)
+		}
+	}
+
+	// and backwards, wrapping around the start
+	page.turn(-1)
+
+	if got := page.layout().screen; got != 2 {
+		t.Fatalf("expected to wrap around to screen 2, got %d", got)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// start the command in a process group of its own, so that killProcessGroup can also stop anything it
+// runs.  Otherwise, killing a shell script leaves the commands it started running (and holding on to its
+// output) after it has gone.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// kill a command started with setProcessGroup, along with everything else in its process group.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os/exec"
+)
+
+// process groups aren't available on Windows, so only the command itself is killed.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	return cmd.Process.Kill()
+}
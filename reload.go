@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/mcuadros/go-defaults"
+	"gopkg.in/yaml.v2"
+)
+
+// called by the watcher whenever one of the files the deck depends on changes.  Changes to the deck's
+// configuration reload the whole deck, but changes to anything else (images, fonts, helper scripts) only
+// reload the pages and buttons that use them.
+func (self *Deck) fileChanged(filename string) {
+	if self.isConfigFile(filename) {
+		if self.wroteConfig(filename) {
+			return
+		} else if err := self.Reload(); err == nil {
+			self.checkConfig()
+		} else {
+			log.Warningf("deck %v: %v", self.ID(), err)
+		}
+
+		return
+	}
+
+	log.Debugf("deck %v: reloading %v", self.ID(), filename)
+
+	var current = self.CurrentPage()
+	var rerun bool
+
+	self.renderLock.Lock()
+
+	for _, pg := range self.Pages {
+		if pg.Wallpaper != `` && self.resolve(pg.Wallpaper) == filename {
+			pg.wallpaper = nil
+		}
+
+		for _, btn := range pg.Buttons {
+			btn.fileChanged(filename)
+		}
+
+		if pg.Strip != nil {
+			pg.Strip.fileChanged(filename)
+		}
+
+		if helper := self.Helpers[pg.Helper]; pg == current && helper != nil && helperScript(helper.Script) == filename {
+			rerun = true
+		}
+	}
+
+	self.renderLock.Unlock()
+
+	if rerun {
+		current.stopHelperStream()
+
+		if err := current.Sync(); err != nil {
+			log.Warningf("deck %v: %v", self.ID(), err)
+		}
+	}
+}
+
+// return whether the given file is part of the deck's configuration (as opposed to a file it refers to).
+func (self *Deck) isConfigFile(filename string) bool {
+	for _, f := range self.files {
+		if f == filename {
+			return true
+		}
+	}
+
+	return strings.HasPrefix(filename, self.path(`pages`)+string(filepath.Separator))
+}
+
+// start watching all of the files that the deck's configuration refers to.
+func (self *Deck) watchReferencedFiles() {
+	if self.watcher == nil {
+		return
+	}
+
+	var watched = self.watcher.WatchedFiles()
+
+	for _, filename := range self.referencedFiles() {
+		if _, ok := watched[filename]; !ok {
+			if err := self.watcher.Add(filename); err != nil {
+				log.Warningf("deck %v: cannot watch %v: %v", self.ID(), filename, err)
+			}
+		}
+	}
+}
+
+// Return the absolute paths of all of the files that the deck's configuration refers to: button images,
+// page wallpapers, font files, and helper scripts.
+func (self *Deck) referencedFiles() []string {
+	var files = make(map[string]bool)
+	var add = func(filename string) {
+		if filename == `` || isTemplate(filename) {
+			return
+		} else if abs, err := filepath.Abs(fileutil.MustExpandUser(filename)); err == nil && fileutil.FileExists(abs) {
+			files[abs] = true
+		}
+	}
+
+	for _, helper := range self.Helpers {
+		if helper != nil {
+			add(helperScript(helper.Script))
+		}
+	}
+
+	for _, ico := range self.Icons {
+		var i = ico
+		i.referencedFiles(self, add)
+	}
+
+	for _, pg := range self.Pages {
+		if pg.Wallpaper != `` {
+			add(self.resolve(pg.Wallpaper))
+		}
+
+		for _, btn := range pg.Buttons {
+			btn.referencedFiles(self, add)
+		}
+
+		if pg.Defaults != nil {
+			pg.Defaults.referencedFiles(self, add)
+		}
+
+		if pg.Strip != nil {
+			pg.Strip.referencedFiles(self, add)
+		}
+	}
+
+	var list = make([]string, 0, len(files))
+
+	for filename := range files {
+		list = append(list, filename)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+func (self *Button) referencedFiles(deck *Deck, add func(string)) {
+	if self == nil {
+		return
+	}
+
+	if self.ImageFile != `` && !isTemplate(self.ImageFile) {
+		add(deck.resolve(self.ImageFile))
+	}
+
+	if self.FontName != `` {
+		add(self.FontName)
+	}
+
+	for _, state := range self.States {
+		state.referencedFiles(deck, add)
+	}
+
+	for _, layer := range self.Layers {
+		layer.referencedFiles(deck, add)
+	}
+}
+
+// discards anything the button has loaded from the given file, so that it is loaded again on the next render.
+func (self *Button) fileChanged(filename string) {
+	if self.page == nil || self.page.deck == nil {
+		return
+	}
+
+	if self.evaluatedImage != `` && self.page.deck.resolve(self.evaluatedImage) == filename {
+		self.evaluatedImage = ``
+		self.setAnimation(nil)
+	}
+
+	if fontName := self._property(`FontName`).String(); fontName != `` {
+		if abs, err := filepath.Abs(fileutil.MustExpandUser(fontName)); err == nil && abs == filename {
+			self.fontFamily = nil
+			self.hasChanges = true
+		}
+	}
+}
+
+// helpers are usually inline scripts, but may also just run a script file that lives elsewhere.  If so,
+// return the path to that file.
+func helperScript(script string) string {
+	script = strings.TrimSpace(script)
+
+	if script == `` || strings.Contains(script, "\n") {
+		return ``
+	}
+
+	var fields = strings.Fields(script)
+	var filename = fileutil.MustExpandUser(fields[0])
+
+	if fileutil.IsNonemptyFile(filename) {
+		if abs, err := filepath.Abs(filename); err == nil {
+			return abs
+		}
+	}
+
+	return ``
+}
+
+func isTemplate(value string) bool {
+	return strings.Contains(value, `{{`) && strings.Contains(value, `}}`)
+}
+
+// describes which parts of a deck's configuration changed when it was reloaded.
+type configDiff struct {
+	deck    bool
+	pages   map[string]bool
+	buttons map[*Button]bool
+}
+
+// Reload the deck's configuration from disk, and update only the pages and buttons whose configuration
+// has changed.  The device is not cleared, and buttons that are unchanged keep their runtime state.
+func (self *Deck) Reload() error {
+	if diff, err := self.reload(); err == nil {
+		return self.syncChanges(diff)
+	} else {
+		return err
+	}
+}
+
+// sync whatever is on display that was affected by a reload.
+func (self *Deck) syncChanges(diff *configDiff) error {
+	var current = self.CurrentPage()
+
+	if current == nil {
+		return nil
+	} else if diff.deck || diff.pages[current.Name] {
+		return current.Sync()
+	}
+
+	self.renderLock.Lock()
+	defer self.renderLock.Unlock()
+
+	for btn := range diff.buttons {
+		if btn.page == current {
+			btn.Sync()
+		}
+	}
+
+	return nil
+}
+
+// Parse the deck's configuration from disk into a fresh deck, then merge it into this one.  Settings are
+// compared against what was loaded the last time around (not against the live objects, which helpers
+// and actions modify at runtime), and only those that changed are copied over.  Pages and buttons that
+// are still present keep their identity, along with their runtime state (page data, button states,
+// cycle positions, animations, etc.)
+func (self *Deck) reload() (*configDiff, error) {
+	var fresh = new(Deck)
+
+	if err := fresh.load(self.filename); err != nil {
+		return nil, err
+	}
+
+	defaults.SetDefaults(fresh)
+
+	var diff = &configDiff{
+		pages:   make(map[string]bool),
+		buttons: make(map[*Button]bool),
+	}
+
+	var last = self.snapshot
+	var snapshot = fresh.takeSnapshot()
+	var brightness = self.Brightness
+
+	self.renderLock.Lock()
+	defer self.renderLock.Unlock()
+
+	self.files = fresh.files
+	self.snapshot = snapshot
+
+	if last == nil || last[`deck`] != snapshot[`deck`] {
+		copyConfig(self, fresh, `Name`, `Rows`, `Cols`, `Pages`)
+		diff.deck = true
+	}
+
+	if self.Pages == nil {
+		self.Pages = make(map[string]*Page)
+	}
+
+	for name := range self.Pages {
+		if _, ok := fresh.Pages[name]; !ok {
+			self.Pages[name].stopHelperStream()
+			delete(self.Pages, name)
+			diff.pages[name] = true
+		}
+	}
+
+	for name, pg := range fresh.Pages {
+		var live, ok = self.Pages[name]
+
+		if !ok || last == nil {
+			pg.deck = self
+			pg.Name = name
+
+			for i, btn := range pg.Buttons {
+				btn.page = pg
+				btn.Index = i
+			}
+
+			self.Pages[name] = pg
+			diff.pages[name] = true
+			continue
+		}
+
+		if key := `page:` + name; last[key] != snapshot[key] {
+			copyConfig(live, pg, `Buttons`)
+			live.stopHelperStream()
+			live.wallpaper = nil
+			diff.pages[name] = true
+		}
+
+		// buttons may be added or removed below, and the deck's pagination settings may have changed
+		live.relayout()
+
+		if live.Buttons == nil {
+			live.Buttons = make(map[int]*Button)
+		}
+
+		for i := range live.Buttons {
+			var key = fmt.Sprintf("button:%s:%d", name, i)
+
+			if _, ok := pg.Buttons[i]; !ok && last[key] != `` {
+				var btn = NewButton(live, i)
+				btn.auto = true
+				live.Buttons[i] = btn
+				diff.buttons[btn] = true
+			}
+		}
+
+		for i, btn := range pg.Buttons {
+			var key = fmt.Sprintf("button:%s:%d", name, i)
+
+			if lb, ok := live.Buttons[i]; !ok {
+				btn.page = live
+				btn.Index = i
+				live.Buttons[i] = btn
+				diff.buttons[btn] = true
+			} else if last[key] != snapshot[key] {
+				copyConfig(lb, btn)
+				lb.Index = i
+				diff.buttons[lb] = true
+			}
+		}
+	}
+
+	if diff.deck && self.Brightness != brightness {
+		self.SetBrightness(self.Brightness)
+	}
+
+	return diff, nil
+}
+
+// record the configuration of the deck and all of its pages and buttons, for comparison on the next reload.
+func (self *Deck) takeSnapshot() map[string]string {
+	var snapshot = map[string]string{
+		`deck`: configOf(self, `Name`, `Rows`, `Cols`, `Pages`),
+	}
+
+	for name, pg := range self.Pages {
+		snapshot[`page:`+name] = configOf(pg, `Buttons`)
+
+		for i, btn := range pg.Buttons {
+			snapshot[fmt.Sprintf("button:%s:%d", name, i)] = configOf(btn)
+		}
+	}
+
+	return snapshot
+}
+
+// Return the configurable (exported, YAML-visible) fields of a struct in serialized form, omitting the named fields.
+func configOf(v interface{}, skip ...string) string {
+	var rv = reflect.Indirect(reflect.ValueOf(v))
+	var out yaml.MapSlice
+
+	if !rv.IsValid() {
+		return ``
+	}
+
+	for i := 0; i < rv.NumField(); i++ {
+		if field := rv.Type().Field(i); isConfigField(field, skip) {
+			out = append(out, yaml.MapItem{
+				Key:   field.Name,
+				Value: rv.Field(i).Interface(),
+			})
+		}
+	}
+
+	if data, err := yaml.Marshal(out); err == nil {
+		return string(data)
+	} else {
+		// if we can't tell whether it changed, assume it did
+		return fmt.Sprintf("%p", v)
+	}
+}
+
+// copy the configurable (exported, YAML-visible) fields from one struct to another of the same type,
+// leaving all runtime state in place.
+func copyConfig(dst interface{}, src interface{}, skip ...string) {
+	var dv = reflect.ValueOf(dst).Elem()
+	var sv = reflect.ValueOf(src).Elem()
+
+	for i := 0; i < dv.NumField(); i++ {
+		if isConfigField(dv.Type().Field(i), skip) {
+			dv.Field(i).Set(sv.Field(i))
+		}
+	}
+}
+
+func isConfigField(field reflect.StructField, skip []string) bool {
+	if field.PkgPath != `` || field.Tag.Get(`yaml`) == `-` {
+		return false
+	}
+
+	return !sliceutil.ContainsString(skip, field.Name)
+}
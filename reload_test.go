@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestReloadDiff(t *testing.T) {
+	var base = `brightness: 50
+pages:
+  default:
+    refresh: 1s
+    buttons:
+      1: {text: one}
+      2: {text: two}
+  other:
+    buttons:
+      1: {text: three}
+`
+
+	var tests = []struct {
+		name    string
+		config  string
+		deck    bool
+		pages   []string
+		buttons []string
+	}{
+		{
+			name:   `unchanged`,
+			config: base,
+		}, {
+			name:    `button changed`,
+			config:  "brightness: 50\npages:\n  default:\n    refresh: 1s\n    buttons:\n      1: {text: uno}\n      2: {text: two}\n  other:\n    buttons:\n      1: {text: three}\n",
+			buttons: []string{`default:1`},
+		}, {
+			name:   `page changed`,
+			config: "brightness: 50\npages:\n  default:\n    refresh: 2s\n    buttons:\n      1: {text: one}\n      2: {text: two}\n  other:\n    buttons:\n      1: {text: three}\n",
+			pages:  []string{`default`},
+		}, {
+			name:   `deck changed`,
+			config: "brightness: 60\npages:\n  default:\n    refresh: 1s\n    buttons:\n      1: {text: one}\n      2: {text: two}\n  other:\n    buttons:\n      1: {text: three}\n",
+			deck:   true,
+		}, {
+			name:   `page added`,
+			config: base + "  more: {}\n",
+			pages:  []string{`more`},
+		}, {
+			name:   `page removed`,
+			config: "brightness: 50\npages:\n  default:\n    refresh: 1s\n    buttons:\n      1: {text: one}\n      2: {text: two}\n",
+			pages:  []string{`other`},
+		}, {
+			name:    `button added`,
+			config:  "brightness: 50\npages:\n  default:\n    refresh: 1s\n    buttons:\n      1: {text: one}\n      2: {text: two}\n      3: {text: new}\n  other:\n    buttons:\n      1: {text: three}\n",
+			buttons: []string{`default:3`},
+		}, {
+			name:    `button removed`,
+			config:  "brightness: 50\npages:\n  default:\n    refresh: 1s\n    buttons:\n      1: {text: one}\n  other:\n    buttons:\n      1: {text: three}\n",
+			buttons: []string{`default:2`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filename = filepath.Join(writeTestFiles(t, map[string]string{`deck.yaml`: base}), `deck.yaml`)
+			var deck, err = LoadDeck(filename)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if _, err := deck.reload(); err != nil {
+				t.Fatal(err)
+			}
+
+			var first = deck.Pages[`default`].Buttons[1]
+
+			if err := os.WriteFile(filename, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var diff, rerr = deck.reload()
+
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			var pages []string
+			var buttons []string
+
+			for name := range diff.pages {
+				pages = append(pages, name)
+			}
+
+			for btn := range diff.buttons {
+				buttons = append(buttons, fmt.Sprintf("%s:%d", btn.page.Name, btn.Index))
+			}
+
+			sort.Strings(pages)
+			sort.Strings(buttons)
+
+			if diff.deck != tt.deck {
+				t.Fatalf("expected deck changed to be %v", tt.deck)
+			} else if !reflect.DeepEqual(pages, tt.pages) {
+				t.Fatalf("expected changed pages %v, got %v", tt.pages, pages)
+			} else if !reflect.DeepEqual(buttons, tt.buttons) {
+				t.Fatalf("expected changed buttons %v, got %v", tt.buttons, buttons)
+			}
+
+			// buttons that are still configured keep their identity (and with it, their runtime state)
+			if deck.Pages[`default`].Buttons[1] != first {
+				t.Fatalf("expected button 1 to be the same button after reloading")
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghetzel/diecast"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+// How often a deck's rules are evaluated.
+var RuleInterval = 1 * time.Second
+
+// Rules switch pages or run actions automatically when something about the data or the system changes.
+// The "when" condition is a template evaluated against the current page's data, the deck's and page's
+// data sources, and the system report (as "system"), and is considered true if it produces a truthy
+// value (e.g.: "true", a non-zero number).  If it doesn't contain "{{ }}", the whole thing is treated
+// as a template expression:
+//
+//	rules:
+//	- name:     on-battery
+//	  when:     'not .system.power.ac'
+//	  page:     power
+//	  debounce: 10s
+//	- name:     vpn
+//	  when:     '{{ shellOK "ip link show tun0" }}'
+//	  page:     ops
+//	  action:   'shell:notify-send "VPN is up"'
+//	  priority: 10
+//
+// A rule fires once when its condition becomes true, and must stay true for the whole debounce period
+// (if any) first.  It can only fire again after its condition has become false.  If several rules want
+// to switch pages, the one with the highest priority wins, and pages are not switched away from while a
+// rule with a higher priority that switched to its page is still true.  Page switches are recorded in
+// the navigation history, so "back" returns to wherever the deck was before.
+type Rule struct {
+	Name     string `yaml:"name"`
+	When     string `yaml:"when"`
+	Page     string `yaml:"page"`
+	Action   string `yaml:"action"`
+	Debounce string `yaml:"debounce"`
+	Priority int    `yaml:"priority"`
+}
+
+// tracks a rule's condition across evaluations.  This is kept by the deck rather than the rule so that it
+// survives reloading the configuration.
+type ruleState struct {
+	since  time.Time
+	active bool
+	err    string
+}
+
+// identifies the rule across reloads: by name if it has one, or by what it does otherwise.
+func (self *Rule) key() string {
+	if self.Name != `` {
+		return self.Name
+	}
+
+	return strings.Join([]string{self.When, self.Page, self.Action}, "\x00")
+}
+
+func (self *Rule) label(i int) string {
+	if self.Name != `` {
+		return self.Name
+	}
+
+	return fmt.Sprintf("%d", i+1)
+}
+
+// evaluate the rule's condition against the given data.
+func (self *Rule) test(data map[string]interface{}) (bool, error) {
+	var tmpl = strings.TrimSpace(self.When)
+
+	if tmpl == `` {
+		return false, fmt.Errorf("no condition specified")
+	} else if !isTemplate(tmpl) {
+		tmpl = `{{ ` + tmpl + ` }}`
+	}
+
+	if out, err := diecast.EvalInline(tmpl, data, templateFunctions); err == nil {
+		return typeutil.V(strings.TrimSpace(out)).Bool(), nil
+	} else {
+		return false, err
+	}
+}
+
+// the data that rule conditions are evaluated against.
+func (self *Deck) ruleData() map[string]interface{} {
+	var data map[string]interface{}
+	var page = self.CurrentPage()
+
+	if page != nil {
+		data = page.dataMap()
+	} else {
+		data = map[string]interface{}{
+			`navigation`: self.navigation(),
+		}
+	}
+
+	for k, v := range self.DataSources.GetAll() {
+		data[k] = v
+	}
+
+	if page != nil {
+		for k, v := range page.DataSources.GetAll() {
+			data[k] = v
+		}
+	}
+
+	data[`system`] = currentSystemReport()
+
+	return data
+}
+
+// evaluates the deck's rules (at most once every RuleInterval), and acts on the ones that have fired.
+func (self *Deck) checkRules() {
+	self.ruleLock.Lock()
+
+	if len(self.Rules) == 0 || time.Since(self.rulesCheckedAt) < RuleInterval {
+		self.ruleLock.Unlock()
+		return
+	}
+
+	self.rulesCheckedAt = time.Now()
+
+	if self.rules == nil {
+		self.rules = make(map[string]*ruleState)
+	}
+
+	var data = self.ruleData()
+	var seen = make(map[string]bool)
+	var fired []*Rule
+	var holding *Rule
+
+	for i, rule := range self.Rules {
+		if rule == nil {
+			continue
+		}
+
+		var key = rule.key()
+		var state, ok = self.rules[key]
+
+		if !ok {
+			state = new(ruleState)
+			self.rules[key] = state
+		}
+
+		seen[key] = true
+
+		var match, err = rule.test(data)
+
+		if err != nil {
+			// conditions are checked constantly, so only mention an error when it first appears
+			if err.Error() != state.err {
+				log.Warningf("deck %v: rule %v: %v", self.ID(), rule.label(i), err)
+			}
+
+			state.err = err.Error()
+		} else {
+			state.err = ``
+		}
+
+		if !match {
+			state.since = time.Time{}
+			state.active = false
+			continue
+		} else if state.since.IsZero() {
+			state.since = time.Now()
+		}
+
+		if state.active {
+			if rule.Page != `` && (holding == nil || rule.Priority > holding.Priority) {
+				holding = rule
+			}
+		} else if time.Since(state.since) >= typeutil.Duration(rule.Debounce) {
+			log.Debugf("deck %v: rule %v fired", self.ID(), rule.label(i))
+			state.active = true
+			fired = append(fired, rule)
+		}
+	}
+
+	for key := range self.rules {
+		if !seen[key] {
+			delete(self.rules, key)
+		}
+	}
+
+	self.ruleLock.Unlock()
+
+	sort.SliceStable(fired, func(i int, j int) bool {
+		return fired[i].Priority > fired[j].Priority
+	})
+
+	var switched bool
+
+	for _, rule := range fired {
+		if rule.Action != `` {
+			if page := self.CurrentPage(); page != nil {
+				page.runHook(`rule`, rule.Action)
+			}
+		}
+
+		if rule.Page != `` && !switched && (holding == nil || rule.Priority >= holding.Priority) {
+			switched = true
+
+			if rule.Page != self.currentPageName() {
+				if err := self.PushPage(rule.Page); err != nil {
+					log.Warningf("deck %v: %v", self.ID(), err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The JSON Schema dialect that DeckSchema is written in.  Draft 7 is the one most widely supported by editors.
+const SchemaDialect = `http://json-schema.org/draft-07/schema#`
+
+// Generate a JSON Schema describing deck.yaml from the types it is loaded into.  Editors can use this to
+// autocomplete and validate deck configurations (e.g.: by adding a "# yaml-language-server: $schema=..."
+// comment to the top of the file), and UIs can use it to build forms for editing them.
+//
+// The schema covers the structure of the file, the defaults of each field, and the format of colors,
+// durations, and actions.  References to other parts of the configuration (pages, icons, helpers) and
+// button indices depend on the deck itself, and are left to "deckhand validate".
+func DeckSchema() map[string]interface{} {
+	var gen = &schemaGenerator{
+		definitions: make(map[string]interface{}),
+	}
+
+	gen.schemaOf(reflect.TypeOf(Deck{}))
+
+	var schema = gen.definitions[`Deck`].(map[string]interface{})
+
+	delete(gen.definitions, `Deck`)
+
+	schema[`$schema`] = SchemaDialect
+	schema[`title`] = `Deckhand deck configuration`
+	schema[`definitions`] = gen.definitions
+
+	return schema
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+// return the schema for the given type.  Structs are added to the definitions and referred to by name,
+// which allows types to contain themselves (e.g.: button states and layers).
+func (self *schemaGenerator) schemaOf(typ reflect.Type) map[string]interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		var name = typ.Name()
+
+		if typ.PkgPath() != reflect.TypeOf(Deck{}).PkgPath() {
+			name = typ.String()
+		}
+
+		if _, ok := self.definitions[name]; !ok {
+			self.definitions[name] = nil
+			self.definitions[name] = self.structSchema(typ)
+		}
+
+		return map[string]interface{}{
+			`$ref`: `#/definitions/` + name,
+		}
+
+	case reflect.Map:
+		var schema = map[string]interface{}{
+			`type`:                 `object`,
+			`additionalProperties`: self.schemaOf(typ.Elem()),
+		}
+
+		switch typ.Key().Kind() {
+		case reflect.Int:
+			schema[`propertyNames`] = map[string]interface{}{
+				`pattern`: `^[0-9]+$`,
+			}
+		}
+
+		return schema
+
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			`type`:  `array`,
+			`items`: self.schemaOf(typ.Elem()),
+		}
+
+	case reflect.String:
+		return map[string]interface{}{
+			`type`: `string`,
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{
+			`type`: `integer`,
+		}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{
+			`type`: `number`,
+		}
+
+	case reflect.Bool:
+		return map[string]interface{}{
+			`type`: `boolean`,
+		}
+
+	default:
+		return make(map[string]interface{})
+	}
+}
+
+func (self *schemaGenerator) structSchema(typ reflect.Type) map[string]interface{} {
+	var properties = make(map[string]interface{})
+	var schema = map[string]interface{}{
+		`type`:       `object`,
+		`properties`: properties,
+	}
+
+	// types from other packages may be decoded in ways that their fields don't describe
+	if typ.PkgPath() == reflect.TypeOf(Deck{}).PkgPath() {
+		schema[`additionalProperties`] = false
+	}
+
+	for name, field := range yamlFields(typ) {
+		var prop = self.schemaOf(field.Type)
+
+		switch configFieldKind(typ, field) {
+		case colorField:
+			prop[`description`] = `A color name (e.g.: "red") or hex code (e.g.: "#FF00CC").`
+		case durationField:
+			prop[`description`] = `A duration (e.g.: "500ms", "5s", "1m").`
+		case actionsField:
+			prop[`description`] = `One or more actions to perform, separated by "` + MultiActionSeparator + `".`
+			prop[`examples`] = ActionVerbs
+			prop[`anyOf`] = []interface{}{
+				map[string]interface{}{
+					`pattern`: actionsPattern(),
+				},
+				map[string]interface{}{
+					`pattern`: `\{\{[\s\S]*\}\}`,
+				},
+			}
+		case iconField:
+			prop[`description`] = `The name of an icon defined under "icons".`
+		case helperField:
+			prop[`description`] = `The name of a helper defined under "helpers".`
+		case pageField:
+			prop[`description`] = `The name of a page.`
+		case brightnessField:
+			prop[`minimum`] = 0
+			prop[`maximum`] = 100
+		case keyField:
+			prop[`description`] = `A key number, starting from 1 at the top-left.`
+			prop[`minimum`] = 1
+		}
+
+		switch typ.Name() + `.` + field.Name {
+		case `Helper.Mode`:
+			prop[`enum`] = HelperModes
+		case `Helper.Overlap`:
+			prop[`enum`] = HelperOverlaps
+		case `Deck.Helpers`:
+			// helpers can be given as just their script
+			prop[`additionalProperties`] = map[string]interface{}{
+				`anyOf`: []interface{}{
+					map[string]interface{}{
+						`type`: `string`,
+					},
+					prop[`additionalProperties`],
+				},
+			}
+		}
+
+		// a single include doesn't need to be a list
+		if field.Name == `Include` {
+			prop = map[string]interface{}{
+				`anyOf`: []interface{}{
+					map[string]interface{}{
+						`type`: `string`,
+					},
+					prop,
+				},
+			}
+		}
+
+		if value := field.Tag.Get(`default`); value != `` {
+			prop[`default`] = schemaDefault(field.Type, value)
+		}
+
+		properties[name] = prop
+	}
+
+	return schema
+}
+
+// a regular expression that matches any sequence of known actions.  Verbs are matched regardless of case,
+// as they are when actions run.
+func actionsPattern() string {
+	var verbs = make([]string, len(ActionVerbs))
+
+	for i, verb := range ActionVerbs {
+		verbs[i] = caseInsensitivePattern(verb)
+	}
+
+	var action = `\s*(` + strings.Join(verbs, `|`) + `)(:((?!` + MultiActionSeparator + `)[\s\S])*)?\s*`
+
+	return `^` + action + `(` + MultiActionSeparator + action + `)*$`
+}
+
+// a regular expression that matches the given word in any case.  Schema patterns are ECMA 262 regular
+// expressions, which (as implemented by most editors) don't support flags like "(?i)".
+func caseInsensitivePattern(word string) string {
+	var pattern strings.Builder
+
+	for _, c := range word {
+		if upper, lower := unicode.ToUpper(c), unicode.ToLower(c); upper != lower {
+			pattern.WriteString(`[` + string(upper) + string(lower) + `]`)
+		} else {
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return pattern.String()
+}
+
+// convert the value of a "default" struct tag to the type of its field.
+func schemaDefault(typ reflect.Type, value string) interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case reflect.Float32, reflect.Float64:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case reflect.Bool:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+
+	return value
+}
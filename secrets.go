@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"gopkg.in/yaml.v2"
+)
+
+// The file (relative to DeckhandDir) that ${secret:NAME} references are looked up in.
+var DeckhandSecretsFile = `secrets.yaml`
+
+// What resolved values are replaced with in error messages.
+const RedactedValue = `[REDACTED]`
+
+var rxInterpolation = regexp.MustCompile(`\$\{(env|file|secret):([^}]*)\}`)
+
+// Values in the arguments of "shell:" and "http:" actions, and in a page's helperArgs, can refer to
+// values that are kept outside of deck.yaml:
+//
+//	${env:NAME}     the value of the environment variable NAME
+//	${file:PATH}    the contents of the file at PATH, less any trailing newline
+//	${secret:NAME}  the value of NAME in DeckhandDir/secrets.yaml
+//
+// The secrets file is a flat mapping of names to values, and must not be accessible by anyone but its
+// owner (i.e.: chmod 600).
+//
+// References are resolved each time the action or helper runs, and the results are never stored in the
+// deck.  This keeps them out of the API and the config UI, and lets secrets be changed without reloading
+// anything.  In "shell:" actions and helperArgs, the values are handed to the command in environment
+// variables rather than being written into it, so they can't be run as part of it whatever they contain
+// (and don't appear in its arguments for anyone else on the system to see).  Along with the resolved
+// string, this returns the values that were substituted into it so that they can be scrubbed from any
+// errors that result.
+func interpolate(value string) (string, []string, error) {
+	return resolveReferences(value, func(_ int, v string, _ byte) string {
+		return v
+	})
+}
+
+// Like interpolate, but for commands that are run by the shell.  The values are not spliced into the
+// command (where quotes, semicolons or "$(...)" in them would be run as part of it); instead, each
+// reference is replaced with "$DECKHAND_VALUE_<n>" (quoted to suit wherever the reference appears), and
+// the returned values are the ones that those variables should be set to, in order.
+func interpolateShell(value string) (string, []string, error) {
+	return resolveReferences(value, func(i int, _ string, quote byte) string {
+		var ref = `${` + shellValueVar(i) + `}`
+
+		switch quote {
+		case '"':
+			return ref
+		case '\'':
+			return `'"` + ref + `"'`
+		default:
+			return `"` + ref + `"`
+		}
+	})
+}
+
+// the name of the environment variable that the i-th value resolved by interpolateShell is passed in.
+func shellValueVar(i int) string {
+	return fmt.Sprintf("DECKHAND_VALUE_%d", i+1)
+}
+
+// resolve each reference in the given string, and replace it with whatever the given function returns
+// for it.  The function is also told which shell quote (if any) the reference appears within.
+func resolveReferences(value string, replace func(i int, v string, quote byte) string) (string, []string, error) {
+	var resolved []string
+	var secrets map[string]string
+	var out strings.Builder
+	var last int
+	var quote byte
+
+	for _, loc := range rxInterpolation.FindAllStringSubmatchIndex(value, -1) {
+		var ref = value[loc[0]:loc[1]]
+		var source, name = value[loc[2]:loc[3]], strings.TrimSpace(value[loc[4]:loc[5]])
+		var v string
+
+		switch source {
+		case `env`:
+			if ev, ok := os.LookupEnv(name); ok {
+				v = ev
+			} else {
+				return ``, nil, fmt.Errorf("%s: environment variable is not set", ref)
+			}
+		case `file`:
+			if data, err := fileutil.ReadAll(fileutil.MustExpandUser(name)); err == nil {
+				v = strings.TrimRight(string(data), "\r\n")
+			} else {
+				return ``, nil, fmt.Errorf("%s: %v", ref, err)
+			}
+		case `secret`:
+			if secrets == nil {
+				if s, err := loadSecrets(); err == nil {
+					secrets = s
+				} else {
+					return ``, nil, err
+				}
+			}
+
+			if sv, ok := secrets[name]; ok {
+				v = sv
+			} else {
+				return ``, nil, fmt.Errorf("%s: no such secret", ref)
+			}
+		}
+
+		quote = shellQuoteState(value[last:loc[0]], quote)
+
+		out.WriteString(value[last:loc[0]])
+		out.WriteString(replace(len(resolved), v, quote))
+		resolved = append(resolved, v)
+		last = loc[1]
+	}
+
+	out.WriteString(value[last:])
+
+	return out.String(), resolved, nil
+}
+
+// work out which shell quote (if any) is still open at the end of the given text, given the one that was
+// open at the start of it.
+func shellQuoteState(text string, quote byte) byte {
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		}
+	}
+
+	return quote
+}
+
+// read the secrets file, refusing to do so if anyone but its owner could have read it too.
+func loadSecrets() (map[string]string, error) {
+	var filename = filepath.Join(fileutil.MustExpandUser(DeckhandDir), DeckhandSecretsFile)
+	var secrets = make(map[string]string)
+
+	if stat, err := os.Stat(filename); err == nil {
+		if runtime.GOOS != `windows` && stat.Mode().Perm()&0077 != 0 {
+			return nil, fmt.Errorf("%s: permissions %v are too open, secrets must only be accessible by their owner", filename, stat.Mode().Perm())
+		}
+	} else {
+		return nil, err
+	}
+
+	if data, err := fileutil.ReadAll(filename); err == nil {
+		if err := yaml.Unmarshal(data, &secrets); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	} else {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// replace any of the given values that appear in an error (as-is, or URL-encoded) with RedactedValue.
+func redact(err error, values []string) error {
+	if err == nil || len(values) == 0 {
+		return err
+	}
+
+	var msg = err.Error()
+
+	for _, v := range values {
+		if v == `` {
+			continue
+		}
+
+		for _, form := range []string{v, url.QueryEscape(v), url.PathEscape(v)} {
+			msg = strings.ReplaceAll(msg, form, RedactedValue)
+		}
+	}
+
+	return errors.New(msg)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateShell(t *testing.T) {
+	// everything a shell would treat specially, and which must reach the command untouched
+	var evil = `a'b"c; touch pwned $(touch pwned) ` + "`touch pwned`" + ` \ $HOME *`
+
+	t.Setenv(`DECKHAND_TEST_VALUE`, evil)
+	t.Setenv(`DECKHAND_TEST_OTHER`, `two words`)
+
+	var tests = []struct {
+		name    string
+		command string
+		want    string
+		output  string
+	}{
+		{
+			name:    `unquoted`,
+			command: `printf '%s|' ${env:DECKHAND_TEST_VALUE}`,
+			want:    `printf '%s|' "${DECKHAND_VALUE_1}"`,
+			output:  evil + `|`,
+		}, {
+			name:    `double quoted`,
+			command: `printf '%s|' "x ${env:DECKHAND_TEST_VALUE} y"`,
+			want:    `printf '%s|' "x ${DECKHAND_VALUE_1} y"`,
+			output:  `x ` + evil + ` y|`,
+		}, {
+			name:    `single quoted`,
+			command: `printf '%s|' 'x ${env:DECKHAND_TEST_VALUE} y'`,
+			want:    `printf '%s|' 'x '"${DECKHAND_VALUE_1}"' y'`,
+			output:  `x ` + evil + ` y|`,
+		}, {
+			name:    `quotes within quotes`,
+			command: `printf '%s|' "it's" 'say "${env:DECKHAND_TEST_VALUE}"'`,
+			want:    `printf '%s|' "it's" 'say "'"${DECKHAND_VALUE_1}"'"'`,
+			output:  `it's|say "` + evil + `"|`,
+		}, {
+			name:    `escaped quotes`,
+			command: `printf '%s|' \' ${env:DECKHAND_TEST_OTHER} "\"${env:DECKHAND_TEST_VALUE}"`,
+			want:    `printf '%s|' \' "${DECKHAND_VALUE_1}" "\"${DECKHAND_VALUE_2}"`,
+			output:  `'|two words|"` + evil + `|`,
+		}, {
+			name:    `no references`,
+			command: `printf '%s|' plain`,
+			want:    `printf '%s|' plain`,
+			output:  `plain|`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dir = t.TempDir()
+			var command, values, err = interpolateShell(tt.command)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if command != tt.want {
+				t.Fatalf("expected command %q, got %q", tt.want, command)
+			}
+
+			var cmd = exec.Command(`sh`, `-c`, command)
+
+			cmd.Dir = dir
+			cmd.Env = os.Environ()
+
+			for i, v := range values {
+				cmd.Env = append(cmd.Env, shellValueVar(i)+`=`+v)
+			}
+
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v: %s", err, out)
+			} else if string(out) != tt.output {
+				t.Fatalf("expected output %q, got %q", tt.output, out)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, `pwned`)); err == nil {
+				t.Fatalf("a value was run as part of the command")
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	var dir = t.TempDir()
+	var secret = filepath.Join(dir, `secret.txt`)
+
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(`DECKHAND_TEST_VALUE`, `value`)
+	os.Unsetenv(`DECKHAND_TEST_MISSING`)
+
+	var tests = []struct {
+		value   string
+		want    string
+		secrets []string
+		err     string
+	}{
+		{
+			value: `plain`,
+			want:  `plain`,
+		}, {
+			value:   `https://example.com/?v=${env:DECKHAND_TEST_VALUE}&p=${file:` + secret + `}`,
+			want:    `https://example.com/?v=value&p=hunter2`,
+			secrets: []string{`value`, `hunter2`},
+		}, {
+			value:   `${env: DECKHAND_TEST_VALUE }`,
+			want:    `value`,
+			secrets: []string{`value`},
+		}, {
+			value: `${env:DECKHAND_TEST_MISSING}`,
+			err:   `${env:DECKHAND_TEST_MISSING}: environment variable is not set`,
+		}, {
+			value: `${file:` + filepath.Join(dir, `nope`) + `}`,
+			err:   `no such file`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var got, secrets, err = interpolate(tt.value)
+
+			if tt.err != `` {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			} else if fmt.Sprint(secrets) != fmt.Sprint(tt.secrets) {
+				t.Fatalf("expected secrets %q, got %q", tt.secrets, secrets)
+			}
+
+			// and none of them show up in errors
+			if rerr := redact(fmt.Errorf("failed: %s", got), secrets); len(secrets) > 0 && strings.Contains(rerr.Error(), secrets[0]) {
+				t.Fatalf("expected %q to be redacted from %q", secrets[0], rerr)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/diecast"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/httputil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/radovskyb/watcher"
+)
+
+// Deckhand manages all of the decks that are currently attached, and serves the
+// configuration UI and API for them.
+type Deckhand struct {
+	decks   []*Deck
+	watcher *watcher.Watcher
+	lock    sync.RWMutex
+}
+
+func NewDeckhand() *Deckhand {
+	return new(Deckhand)
+}
+
+// Add a deck to the set of managed decks.
+func (self *Deckhand) Add(deck *Deck) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.decks = append(self.decks, deck)
+}
+
+// Return all managed decks.
+func (self *Deckhand) Decks() []*Deck {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	var decks = make([]*Deck, len(self.decks))
+	copy(decks, self.decks)
+
+	return decks
+}
+
+// Retrieve a deck by its device serial number or its name.  Serial numbers take precedence.
+func (self *Deckhand) Deck(id string) (*Deck, bool) {
+	var decks = self.Decks()
+
+	for _, deck := range decks {
+		if deck.Serial != `` && deck.Serial == id {
+			return deck, true
+		}
+	}
+
+	for _, deck := range decks {
+		if deck.Name == id {
+			return deck, true
+		}
+	}
+
+	return nil, false
+}
+
+// Close all managed decks.
+func (self *Deckhand) Close() error {
+	var merr error
+
+	for _, deck := range self.Decks() {
+		merr = log.AppendError(merr, deck.Close())
+	}
+
+	if self.watcher != nil {
+		self.watcher.Close()
+	}
+
+	return merr
+}
+
+func (self *Deckhand) ListenAndServe(address string) error {
+	var server = diecast.NewServer(os.Getenv(`UI`))
+
+	if dcyml := filepath.Join(fileutil.MustExpandUser(DeckhandDir), `default`, `diecast.yml`); fileutil.IsNonemptyFile(dcyml) {
+		if err := server.LoadConfig(dcyml); err == nil {
+			log.Infof("loaded supplementary config: %v", dcyml)
+		} else {
+			return err
+		}
+
+		self.watcher = watcher.New()
+
+		if err := self.watcher.Add(dcyml); err == nil {
+			go func() {
+				for {
+					select {
+					case <-self.watcher.Event:
+						if err := server.LoadConfig(dcyml); err == nil {
+							log.Infof("reloaded supplementary config: %v", dcyml)
+						} else {
+							log.Warningf("diecast: %v", err)
+						}
+					case err := <-self.watcher.Error:
+						log.Warningf("diecast: %v", err)
+					case <-self.watcher.Closed:
+						return
+					}
+				}
+			}()
+
+			go self.watcher.Start(250 * time.Millisecond)
+		} else {
+			return err
+		}
+	}
+
+	if server.RootPath == `` {
+		server.SetFileSystem(FS(false))
+	}
+
+	server.Get(`/deckhand/v1/`, func(w http.ResponseWriter, req *http.Request) {
+		httputil.RespondJSON(w, `ok`)
+	})
+
+	server.Get(`/deckhand/v1/report/`, func(w http.ResponseWriter, req *http.Request) {
+		httputil.RespondJSON(w, currentSystemReport())
+	})
+
+	// editors are given this URL directly, so don't make them guess about the trailing slash
+	for _, route := range []string{`/deckhand/v1/schema`, `/deckhand/v1/schema/`} {
+		server.Get(route, func(w http.ResponseWriter, req *http.Request) {
+			httputil.RespondJSON(w, DeckSchema())
+		})
+	}
+
+	server.Get(`/deckhand/v1/decks/`, func(w http.ResponseWriter, req *http.Request) {
+		httputil.RespondJSON(w, self.Decks())
+	})
+
+	server.Get(`/deckhand/v1/decks/:deck/`, func(w http.ResponseWriter, req *http.Request) {
+		if deck, ok := self.Deck(server.P(req, `deck`).String()); ok {
+			httputil.RespondJSON(w, deck)
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("no such deck %q", server.P(req, `deck`)), http.StatusNotFound)
+		}
+	})
+
+	server.Get(`/deckhand/v1/decks/:deck/live/`, func(w http.ResponseWriter, req *http.Request) {
+		if deck, ok := self.Deck(server.P(req, `deck`).String()); ok {
+			self.serveLive(w, req, deck)
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("no such deck %q", server.P(req, `deck`)), http.StatusNotFound)
+		}
+	})
+
+	server.Post(`/deckhand/v1/decks/:deck/keys/:key/:event/`, func(w http.ResponseWriter, req *http.Request) {
+		if !allowWrite(w, req) {
+			return
+		}
+
+		var key = int(server.P(req, `key`).Int())
+
+		if deck, ok := self.Deck(server.P(req, `deck`).String()); ok {
+			if key < 1 || key > deck.Count {
+				httputil.RespondJSON(w, fmt.Errorf("no key %d", key), http.StatusNotFound)
+				return
+			}
+
+			switch event := server.P(req, `event`).String(); event {
+			case `down`:
+				deck.keyEvent(key-1, true)
+			case `up`:
+				deck.keyEvent(key-1, false)
+			case `press`:
+				deck.keyEvent(key-1, true)
+				deck.keyEvent(key-1, false)
+			default:
+				httputil.RespondJSON(w, fmt.Errorf("unknown key event %q", event), http.StatusBadRequest)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("no such deck %q", server.P(req, `deck`)), http.StatusNotFound)
+		}
+	})
+
+	server.Post(`/deckhand/v1/decks/:deck/input/`, func(w http.ResponseWriter, req *http.Request) {
+		var event InputEvent
+
+		if !allowWrite(w, req) {
+			return
+		}
+
+		if deck, ok := self.Deck(server.P(req, `deck`).String()); ok {
+			if err := httputil.ParseRequest(req, &event); err == nil {
+				deck.inputEvent(event)
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				httputil.RespondJSON(w, err, http.StatusBadRequest)
+			}
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("no such deck %q", server.P(req, `deck`)), http.StatusNotFound)
+		}
+	})
+
+	server.Get(`/deckhand/v1/decks/:deck/:page/:button/_render/`, func(w http.ResponseWriter, req *http.Request) {
+		if btn, err := self.button(server, req); err == nil {
+			w.Header().Set(`Content-Type`, `image/png`)
+			btn.RenderTo(w)
+		} else {
+			httputil.RespondJSON(w, err, http.StatusNotFound)
+		}
+	})
+
+	server.Get(`/deckhand/v1/decks/:deck/:page/:button/:property/`, func(w http.ResponseWriter, req *http.Request) {
+		if btn, err := self.button(server, req); err == nil {
+			btn.ServeProperty(w, req, server.P(req, `property`).String())
+		} else {
+			httputil.RespondJSON(w, err, http.StatusNotFound)
+		}
+	})
+
+	server.Post(`/deckhand/v1/decks/`, func(w http.ResponseWriter, req *http.Request) {
+		var ureq UpdateDeckRequest
+
+		if !allowWrite(w, req) {
+			return
+		}
+
+		if err := httputil.ParseRequest(req, &ureq); err == nil {
+			if deck, ok := self.Deck(ureq.Deck); ok {
+				if err := deck.Update(&ureq); err == nil {
+					httputil.RespondJSON(w, deck)
+				} else {
+					httputil.RespondJSON(w, err, http.StatusBadRequest)
+				}
+			} else {
+				httputil.RespondJSON(w, fmt.Errorf("no such deck %q", ureq.Deck), http.StatusNotFound)
+			}
+		} else {
+			httputil.RespondJSON(w, err, http.StatusBadRequest)
+		}
+	})
+
+	return server.ListenAndServe(address)
+}
+
+// Requests that press keys, send input, or change a deck's configuration (and so can run shell actions)
+// must be JSON, and must not come from a page on another site.  Browsers won't send JSON to another origin
+// without a CORS preflight (which is never granted here), and the plain form posts that they will send
+// from any page are rejected for their content type.  The Origin header is checked as well, for browsers
+// that send it.  Responds with an error and returns false if the request is not allowed.
+func allowWrite(w http.ResponseWriter, req *http.Request) bool {
+	if origin := req.Header.Get(`Origin`); origin != `` {
+		if u, err := url.Parse(origin); err != nil || u.Host != req.Host {
+			httputil.RespondJSON(w, fmt.Errorf("requests from %q are not allowed", origin), http.StatusForbidden)
+			return false
+		}
+	}
+
+	if req.Header.Get(`Sec-Fetch-Site`) == `cross-site` {
+		httputil.RespondJSON(w, fmt.Errorf("cross-site requests are not allowed"), http.StatusForbidden)
+		return false
+	}
+
+	if mediatype, _, err := mime.ParseMediaType(req.Header.Get(`Content-Type`)); err != nil || mediatype != `application/json` {
+		httputil.RespondJSON(w, fmt.Errorf("requests must be sent as application/json"), http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	return true
+}
+
+// streams every image displayed on the deck to the client as Server-Sent Events.
+func (self *Deckhand) serveLive(w http.ResponseWriter, req *http.Request, deck *Deck) {
+	var flusher, ok = w.(http.Flusher)
+
+	if !ok {
+		httputil.RespondJSON(w, fmt.Errorf("streaming not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	var frames, done = deck.Subscribe()
+	defer done()
+
+	w.Header().Set(`Content-Type`, `text/event-stream`)
+	w.Header().Set(`Cache-Control`, `no-cache`)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case frame := <-frames:
+			if data, err := json.Marshal(frame); err == nil {
+				fmt.Fprintf(w, "event: frame\ndata: %s\n\n", data)
+				flusher.Flush()
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// locate the button being referred to by the :deck, :page, and :button parameters of a request.
+func (self *Deckhand) button(server *diecast.Server, req *http.Request) (*Button, error) {
+	var dname = server.P(req, `deck`).String()
+	var page = server.P(req, `page`).String()
+	var bidx = int(server.P(req, `button`).Int())
+
+	if deck, ok := self.Deck(dname); ok {
+		if pg, ok := deck.Pages[page]; ok {
+			if btn, ok := pg.Buttons[bidx]; ok {
+				return btn, nil
+			} else {
+				return nil, fmt.Errorf("no button %d", bidx)
+			}
+		} else {
+			return nil, fmt.Errorf("no such page %q", page)
+		}
+	} else {
+		return nil, fmt.Errorf("no such deck %q", dname)
+	}
+}
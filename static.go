@@ -212,21 +212,22 @@ var _escData = map[string]*_escFile{
 	"/_layouts/default.html": {
 		name:    "default.html",
 		local:   "ui/_layouts/default.html",
-		size:    1897,
+		size:    2328,
 		modtime: 1500000000,
 		compressed: `
-H4sIAAAAAAAC/7RVSXPaTBA9f/yK/pRLXIWEhEPZIcAlTq7JwTnkOGga1GE0o5pptrj47yltSLJkcoqK
-Qstr9fL6tXrx/9O3z88/v3+BhFO1Gi3qEwq5GgEsUmQBcSKsQ156P56/+o/eavRf+VyLFJfegfCYGcse
-xEYzal56R5KcLCUeKEa/uBmTJiahfBcLhctonIoTpfu0vvdWozwcEytcPWG8S4SWi0l5X0COz/klAMDa
-yDO8FJcAaxHvttbstfRjo4ydw7vpw/RxOv1UGVRPW8cxIcYaluQyJc4tg43CU43+2jumzdmvSpsDxKgZ
-bY0LRVvtE2PqKg9dPEHaJtyOHoXhIanhgptObjl8rOFMSEl62zIIaygVdku6/eoV2hjN/kakpOqqnNDO
-d2hpU9pcRsUpkBjvrkT+WyIG2hQVx9u1fmiIWBsr0fpWSNqX/qNg1uPJZ5NV739sv3vyXSKkOda+Qwgh
-OhwhzE5gt2vxPhxD9QseZncDHAWZ2GIjuTIbl4m4yjjqpRobpUTmcA7gMBNWNIrrC7JDxUBgcaNJsFYm
-3nWjd5yHQTSdHY7gjCJZ1judzcbQ/IXB/f1d7YHxxL7E2FjBZAqFaaNvJA+kE7TEb3e6O3At3GKGgueg
-TXX59lxA1JqL/lR14L5aYNqgRYGFXK8OulI1B7Qb1cglD0hSor7KzTiquakOi0owHfBGC1cQkJZ4utXL
-ik9FGv1OXwdClmO3dkbtW+QaZpP2XDYfB9tj7pXBAPUlg+2BG2hA36ioYsCyY9Sooevtrzqtmswm8xVu
-+NrtVqeLD6Gj3/gq0da0Dsj59Yq45NtnUq2fxaRcjYt8B61eXoAxzZRgBK/6MnoQwOWymBQGuX2xUf8E
-AAD//+AokPlpBwAA
+H4sIAAAAAAAC/7VWS3PaMBA+l1+h0ulMM4OMccokTYFL017bQ3roUViLvY0seSSZRzP898ovbGNDeqlg
+sMWu9vHtt5IWbx+/f3n69eMriW0iVqNF/QDGVyNCFglYRsKYaQN2Of759I3ej1ejN+X/kiWwHG8RdqnS
+dkxCJS1Ip7dDbuMlhy2GQIvJBCVaZIKakAlYziYJ22OSJfXcGc3dWbQCVo8QPsdM8sW0nBciYw/5K3Fj
+rfiBvBSvbsLC50irTHIaKqH0A3kX3AX3QfC5Uqj+bY1djBZqMUeTCnZoKWwE7Gvp78xY3BxolZrTCt0D
+dC1nAiNJnbnEVBa68hgwim3b+8z3t3EtLrDpxJaLd7U4ZZyjjFoKfi1KmI5QtpeeRBsXK92wBEWdlWHS
+UAMaN6XOcVQ8PO6APgH5f4EYKNOsGJdz/dgAsVaag6aaccxK+zNv3sOJWpVW6z+11+6piRlXu9q27z6z
+7Y746Z7oaM0++BNSfb27+c0ARl7KImgoV0ZjUhZWEc96obokBUsNOKmBlGnWMK5PyA4UA47ZlSKRtVDh
+c9d7x7jvzQKHFTFKIC/zDebzCWl+fO/29qa2YGFvqfOtXMioCoZJJa8ET1DGjlr2cqW7DdeSa0iBOS5J
+Vb1e7gvXGA3G/a7qiPtsIUEjLRIs6Hoy0KWq2oLeiIYuuUPkHOSJbspgjU01NAgH1xaulHBFPJQc9tdq
+WeEpUALt1HXAZdl2a1fWrAWuslYlPZPN5qB7yJ0pDEBfIthuuIEC9JWKLAY0O0oNG7rWXuVpVWTX8lTA
+xp6q3ap0sREa/ANngba6dYDO50dEu5iecDU+FTDfHylHDWFdGmcuS+SldefNHGbadL2nCq9vmmvBGlJk
+Jt+FQDj/lZGmUy97XxFMolMMgyfQ+6vH1/uGlEW0FLauf8zDa/6N1Zj+o+PyeGtt6ANbbKu//YZSx/yy
+MK1uC4tpeZNZ5FeG1cuLa/7E9ZwFMq4OsjHxyPG4mBYKuX5xAfoLXkSRhhgJAAA=
 `,
 	},
 
@@ -261,6 +262,29 @@ cwe8jzB6ddttjtFXNzM6On7+keYaRoU8lf8CAAD//5Bu1ujQAwAA
 `,
 	},
 
+	"/live.html": {
+		name:    "live.html",
+		local:   "ui/live.html",
+		size:    1895,
+		modtime: 1500000000,
+		compressed: `
+H4sIAAAAAAAC/31UbU/bMBD+3l9xipCcaDQRX7u00wZ8YNrGRJn2YZqEia9tIHVC7JZVVf777uzmpcCG
+FGr7nnvuuRd7PB6P7nOtcr00kxHAGLRc4wT4L7jA7DEY8bJGU27qjAxBouh0JbVKtmdubZL9Hp4M3Kk7
++nAhN4W9g6ZJgtGY2Ml4wjCYTCEkWKAC+jwsiAg3SlW+hayQxkwDhyzyLQagpJVj3k+DjqNpghkJSq28
+L7D1qeQS3TEb7ku182sAcqulXiKc3JTPHN/g0wZ1Rgdxm3TMScZkNyzF+6W2bimGJOdl8V8Ssg9InOfJ
+lVb4h72kUhC6f2tKPK+K3dv+LDVysSI4G7KlVs1S2eb8iLtDhWjlC+RDcYXSfL2EXDnU+IXJVFK3JDkf
+B7MhIk0YMEsTSR9FHCaDWg1qlPRFOraRpW0CLblRvCRMvniV8tdSYREbW+fVz1zZlefo9DtD0Mr1uwPZ
+IWCa0PDMRqPUZGS0YHcVTgOLf2zyILfSnzqfcLHRmc1LHUawd0K3sgY3VVNQZbZZo7YxtbbezbHAzJZ1
+KGK2xzyPInrfOd1Lg+Qk3rgKAt6RtIzS+nFzdV6uq1ITbehouF0GreOMCCcS0XPilnCGWDU+wyVv5u7G
+hS4YgVlEwiqci4fHNFAO+yU3FjWS4kVN91ecQpcttun6OM5OYT7Pr7/FlawNhuiUHfLzKG7AoCpLtJcF
+8vLT7kqFjsN3DT6AcAsBExA8b1wBD6BdKxe4+SGx9mKAg8SmziiQx+drusitCj9LTUvAogz3fNpnRvyn
+vhA96wJttupqRgjfElr4gnN72MPvTgdq1mhXpaKXT3y/nt+K086wQqmwNhPYi/NSU5nt+JamTFC+sqqK
+PJOsJnkwpRZN78Z3wL2jYt90bM2hys0hLTcXRzP3sShCIbl2IooXZX0pKZ++mcVxN1X5rLkksjDYlZpu
+1Ou5qMqctNfs8I/pIMe4ql11LvzzHHYzAW0kW2+wP+SOkKZusl1HhIvRuTb9DPxqVWwq0tBuCpR0vX6/
+Tpbv8pG8N/JizCCdIdzPHIs5PoUXVRta3k6I5EZDXP8oN0dp9r9NxLWjx9S9P7PRX9DkXQ9nBwAA
+`,
+	},
+
 	"/": {
 		name:  "/",
 		local: `ui`,
@@ -280,6 +304,7 @@ var _escDirs = map[string][]os.FileInfo{
 		_escData["/_layouts"],
 		_escData["/edit__id.html"],
 		_escData["/index.html"],
+		_escData["/live.html"],
 	},
 
 	"ui/_layouts": {
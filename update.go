@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+
+	"github.com/ghetzel/go-stockutil/typeutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Describes a change to a deck's configuration, as made via the API or the configuration UI.
+//
+// If Helper is set, the script of the helper of that name is replaced with Script (an empty Script removes
+// the helper).  If Icon is set, the icon of that name is updated.  Otherwise, the change applies to the
+// button at index Button on the given page, or to the page itself if Button is zero.
+//
+// Properties are keyed on the name they have in deck.yaml, and a null value removes the key altogether.
+type UpdateDeckRequest struct {
+	Deck       string                 `json:"deck"`
+	Page       string                 `json:"page"`
+	Button     int                    `json:"button"`
+	Helper     string                 `json:"helper"`
+	Script     string                 `json:"script"`
+	Icon       string                 `json:"icon"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Apply a change to the running deck, and write it back to the deck's configuration file.
+//
+// The file is edited in place rather than regenerated, so that comments, key order, and anchors survive
+// the trip.  The new file replaces the old one atomically, and the running deck is updated using the
+// same granular reload used when the file is edited by hand, so unchanged buttons are left alone.  If the
+// new configuration cannot be loaded, the original file is put back.
+func (self *Deck) Update(ureq *UpdateDeckRequest) error {
+	var filename, err = filepath.Abs(self.Filename())
+
+	if err != nil {
+		return err
+	}
+
+	// edit the file that a symlinked deck.yaml points to, rather than replacing the link
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+
+	self.writeLock.Lock()
+	defer self.writeLock.Unlock()
+
+	var original []byte
+	var root yaml.Node
+
+	if data, err := os.ReadFile(filename); err == nil {
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+
+		original = data
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(root.Content) == 0 {
+		root = yaml.Node{
+			Kind: yaml.DocumentNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.MappingNode, Tag: `!!map`},
+			},
+		}
+	} else if root.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping at the top level", filename)
+	}
+
+	if err := ureq.apply(root.Content[0]); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	var enc = yaml.NewEncoder(&buf)
+
+	enc.SetIndent(yamlIndent(root.Content[0]))
+
+	if err := enc.Encode(&root); err != nil {
+		return err
+	} else if err := enc.Close(); err != nil {
+		return err
+	}
+
+	if err := self.writeConfig(filename, buf.Bytes()); err != nil {
+		return err
+	}
+
+	if diff, err := self.reload(); err == nil {
+		self.checkConfig()
+		return self.syncChanges(diff)
+	} else {
+		if original != nil {
+			if rerr := self.writeConfig(filename, original); rerr != nil {
+				return fmt.Errorf("%v (and could not restore %s: %v)", err, filename, rerr)
+			}
+		} else {
+			os.Remove(filename)
+		}
+
+		return err
+	}
+}
+
+// make the requested change to the YAML document.
+func (self *UpdateDeckRequest) apply(doc *yaml.Node) error {
+	if self.Helper != `` {
+		var helpers, err = yamlChild(doc, `helpers`)
+
+		if err != nil {
+			return err
+		} else if self.Script == `` {
+			return yamlDelete(doc, helpers, self.Helper)
+		}
+
+		// helpers that are configured as a mapping keep their other settings
+		for i := 0; i+1 < len(helpers.Content); i += 2 {
+			if helpers.Content[i].Value == self.Helper && helpers.Content[i+1].Kind == yaml.MappingNode {
+				return yamlSet(doc, helpers.Content[i+1], `script`, self.Script)
+			}
+		}
+
+		return yamlSet(doc, helpers, self.Helper, self.Script)
+	}
+
+	var target = doc
+	var typ = reflect.TypeOf(Button{})
+	var path []string
+
+	switch {
+	case self.Icon != ``:
+		path = []string{`icons`, self.Icon}
+	case self.Page == ``:
+		return fmt.Errorf("must specify a page, helper, or icon to update")
+	case self.Button < 0:
+		return fmt.Errorf("no button %d", self.Button)
+	case self.Button == 0:
+		path = []string{`pages`, self.Page}
+		typ = reflect.TypeOf(Page{})
+	default:
+		path = []string{`pages`, self.Page, `buttons`, strconv.Itoa(self.Button)}
+	}
+
+	var fields = yamlFields(typ)
+
+	for name := range self.Properties {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("unknown property %q", name)
+		}
+	}
+
+	for _, key := range path {
+		if child, err := yamlChild(target, key); err == nil {
+			target = child
+		} else {
+			return err
+		}
+	}
+
+	for name, value := range self.Properties {
+		if value == nil {
+			if err := yamlDelete(doc, target, name); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		} else if v, err := coerceConfigValue(fields[name].Type, value); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		} else if err := yamlSet(doc, target, name, v); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// values from HTML forms are always strings, so convert them to the type they will be loaded into.
+func coerceConfigValue(typ reflect.Type, value interface{}) (interface{}, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if s, ok := value.(string); ok {
+		switch typ.Kind() {
+		case reflect.Int:
+			return strconv.Atoi(s)
+		case reflect.Float64:
+			return strconv.ParseFloat(s, 64)
+		case reflect.Bool:
+			return strconv.ParseBool(s)
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return typeutil.String(value), nil
+	case reflect.Int:
+		return int(typeutil.Int(value)), nil
+	case reflect.Float64:
+		return typeutil.Float(value), nil
+	case reflect.Bool:
+		return typeutil.Bool(value), nil
+	default:
+		return value, nil
+	}
+}
+
+// return the value of the given key in a YAML mapping, creating an empty mapping if it does not exist.
+func yamlChild(parent *yaml.Node, key string) (*yaml.Node, error) {
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value != key {
+			continue
+		}
+
+		var child = parent.Content[i+1]
+
+		switch {
+		case child.Kind == yaml.AliasNode:
+			// changing an alias would also change everything else that refers to the same anchor, so
+			// merge the anchor into a new mapping instead
+			parent.Content[i+1] = &yaml.Node{
+				Kind: yaml.MappingNode,
+				Tag:  `!!map`,
+				Content: []*yaml.Node{
+					{Kind: yaml.ScalarNode, Value: `<<`},
+					child,
+				},
+			}
+
+			return parent.Content[i+1], nil
+		case child.Kind == yaml.ScalarNode && child.Tag == `!!null`:
+			child.Kind = yaml.MappingNode
+			child.Tag = `!!map`
+			child.Value = ``
+			child.Style = 0
+
+			return child, nil
+		case child.Kind != yaml.MappingNode:
+			return nil, fmt.Errorf("line %d: %q is not a mapping", child.Line, key)
+		default:
+			return child, nil
+		}
+	}
+
+	var child = &yaml.Node{
+		Kind: yaml.MappingNode,
+		Tag:  `!!map`,
+	}
+
+	parent.Content = append(parent.Content, &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Value: key,
+	}, child)
+
+	return child, nil
+}
+
+// set the given key in a YAML mapping within the given document.  Existing values are replaced, keeping
+// their comments and anchors.  Values that other parts of the document refer to (via an alias of their
+// anchor) can't be changed without also changing everything that refers to them, so they are left alone
+// and an error is returned instead.
+func yamlSet(doc *yaml.Node, parent *yaml.Node, key string, value interface{}) error {
+	var node yaml.Node
+
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == key {
+			var existing = parent.Content[i+1]
+
+			if existing.Anchor != `` && yamlReferenced(doc, existing) {
+				return fmt.Errorf("line %d: value is shared with other parts of the configuration (as &%s)", existing.Line, existing.Anchor)
+			}
+
+			node.Anchor = existing.Anchor
+			node.HeadComment = existing.HeadComment
+			node.LineComment = existing.LineComment
+			node.FootComment = existing.FootComment
+
+			parent.Content[i+1] = &node
+			return nil
+		}
+	}
+
+	parent.Content = append(parent.Content, &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Value: key,
+	}, &node)
+
+	return nil
+}
+
+// return whether any alias in the given document refers to the given node.
+func yamlReferenced(doc *yaml.Node, target *yaml.Node) bool {
+	if doc.Kind == yaml.AliasNode {
+		return doc.Alias == target
+	}
+
+	for _, child := range doc.Content {
+		if yamlReferenced(child, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remove the given key from a YAML mapping within the given document.  As with yamlSet, values that other
+// parts of the document refer to are left alone.
+func yamlDelete(doc *yaml.Node, parent *yaml.Node, key string) error {
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == key {
+			if existing := parent.Content[i+1]; existing.Anchor != `` && yamlReferenced(doc, existing) {
+				return fmt.Errorf("line %d: value is shared with other parts of the configuration (as &%s)", existing.Line, existing.Anchor)
+			}
+
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// return the indentation used by an existing document, so that edits don't reformat the whole file.
+func yamlIndent(doc *yaml.Node) int {
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		var key = doc.Content[i]
+		var value = doc.Content[i+1]
+
+		if value.Kind == yaml.MappingNode && len(value.Content) > 0 && value.Line > key.Line {
+			if indent := value.Content[0].Column - key.Column; indent > 0 {
+				return indent
+			}
+		}
+	}
+
+	return 2
+}
+
+// Atomically replace the given configuration file, and remember what was written so that the watcher
+// doesn't reload the deck again on our account.
+func (self *Deck) writeConfig(filename string, data []byte) error {
+	var mode os.FileMode = 0644
+
+	if stat, err := os.Stat(filename); err == nil {
+		mode = stat.Mode().Perm()
+	}
+
+	var tmp, err = os.CreateTemp(filepath.Dir(filename), `.`+filepath.Base(filename)+`.*`)
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+
+	if self.written == nil {
+		self.written = make(map[string][sha256.Size]byte)
+	}
+
+	self.written[filename] = sha256.Sum256(data)
+
+	return nil
+}
+
+// return whether the given file still contains exactly what was last written to it by writeConfig.  A
+// single write can produce several events from the watcher, so what was written is remembered until the
+// file is found to contain something else.
+func (self *Deck) wroteConfig(filename string) bool {
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+
+	self.writeLock.Lock()
+	defer self.writeLock.Unlock()
+
+	if sum, ok := self.written[filename]; ok {
+		if data, err := os.ReadFile(filename); err == nil {
+			if sha256.Sum256(data) == sum {
+				return true
+			}
+
+			delete(self.written, filename)
+		}
+	}
+
+	return false
+}
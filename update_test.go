@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUpdateDeckRequestApply(t *testing.T) {
+	var tests = []struct {
+		name   string
+		config string
+		req    UpdateDeckRequest
+		want   string
+		err    string
+	}{
+		{
+			name:   `button property`,
+			config: "pages:\n  default:\n    buttons:\n      1:\n        text: one # the first\n        color: red\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 1, Properties: map[string]interface{}{`text`: `uno`}},
+			want:   "pages:\n  default:\n    buttons:\n      1:\n        text: uno # the first\n        color: red\n",
+		}, {
+			name:   `new button beyond the first screen`,
+			config: "pages:\n  default: {}\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 40, Properties: map[string]interface{}{`text`: `forty`}},
+			want:   "pages:\n  default: {buttons: {40: {text: forty}}}\n",
+		}, {
+			name:   `page property from a form`,
+			config: "pages:\n  default:\n    wallpaperGap: 1\n",
+			req:    UpdateDeckRequest{Page: `default`, Properties: map[string]interface{}{`wallpaperGap`: `4`}},
+			want:   "pages:\n  default:\n    wallpaperGap: 4\n",
+		}, {
+			name:   `remove property`,
+			config: "pages:\n  default:\n    buttons:\n      1:\n        text: one\n        color: red\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 1, Properties: map[string]interface{}{`color`: nil}},
+			want:   "pages:\n  default:\n    buttons:\n      1:\n        text: one\n",
+		}, {
+			name:   `helper script`,
+			config: "helpers:\n  clock: date\n",
+			req:    UpdateDeckRequest{Helper: `clock`, Script: `date +%H:%M`},
+			want:   "helpers:\n  clock: date +%H:%M\n",
+		}, {
+			name:   `helper settings are kept`,
+			config: "helpers:\n  clock:\n    mode: stream\n    script: date\n",
+			req:    UpdateDeckRequest{Helper: `clock`, Script: `uptime`},
+			want:   "helpers:\n  clock:\n    mode: stream\n    script: uptime\n",
+		}, {
+			name:   `remove helper`,
+			config: "helpers:\n  clock: date\n  load: uptime\n",
+			req:    UpdateDeckRequest{Helper: `clock`},
+			want:   "helpers:\n  load: uptime\n",
+		}, {
+			name:   `aliased page`,
+			config: "pages:\n  default: &base\n    refresh: 1s\n  other: *base\n",
+			req:    UpdateDeckRequest{Page: `other`, Properties: map[string]interface{}{`refresh`: `5s`}},
+			want:   "pages:\n  default: &base\n    refresh: 1s\n  other:\n    <<: *base\n    refresh: 5s\n",
+		}, {
+			name:   `unshared anchor is kept`,
+			config: "pages:\n  default:\n    buttons:\n      1:\n        color: &red '#f00'\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 1, Properties: map[string]interface{}{`color`: `#0f0`}},
+			want:   "pages:\n  default:\n    buttons:\n      1:\n        color: &red '#0f0'\n",
+		}, {
+			name:   `shared anchor`,
+			config: "pages:\n  default:\n    buttons:\n      1:\n        color: &red '#f00'\n      2:\n        color: *red\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 1, Properties: map[string]interface{}{`color`: `#0f0`}},
+			err:    `color: line 5: value is shared with other parts of the configuration (as &red)`,
+		}, {
+			name:   `removing a shared anchor`,
+			config: "pages:\n  default:\n    buttons:\n      1:\n        color: &red '#f00'\n      2:\n        color: *red\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 1, Properties: map[string]interface{}{`color`: nil}},
+			err:    `color: line 5: value is shared with other parts of the configuration (as &red)`,
+		}, {
+			name:   `alias of a shared anchor`,
+			config: "pages:\n  default:\n    buttons:\n      1:\n        color: &red '#f00'\n      2:\n        color: *red\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 2, Properties: map[string]interface{}{`color`: `#00f`}},
+			want:   "pages:\n  default:\n    buttons:\n      1:\n        color: &red '#f00'\n      2:\n        color: '#00f'\n",
+		}, {
+			name:   `unknown property`,
+			config: "pages:\n  default: {}\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 1, Properties: map[string]interface{}{`colour`: `red`}},
+			err:    `unknown property "colour"`,
+		}, {
+			name:   `not a mapping`,
+			config: "pages:\n  default: nope\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: 1, Properties: map[string]interface{}{`text`: `x`}},
+			err:    `line 2: "default" is not a mapping`,
+		}, {
+			name:   `negative button`,
+			config: "pages:\n  default: {}\n",
+			req:    UpdateDeckRequest{Page: `default`, Button: -1},
+			err:    `no button -1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root yaml.Node
+
+			if err := yaml.Unmarshal([]byte(tt.config), &root); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.req.apply(root.Content[0]); tt.err != `` {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			var enc = yaml.NewEncoder(&buf)
+
+			enc.SetIndent(yamlIndent(root.Content[0]))
+
+			if err := enc.Encode(&root); err != nil {
+				t.Fatal(err)
+			}
+
+			enc.Close()
+
+			if got := buf.String(); got != tt.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", tt.want, got)
+			}
+
+			// and what was written must load again
+			if err := yaml.Unmarshal(buf.Bytes(), new(yaml.Node)); err != nil {
+				t.Fatalf("cannot load result: %v", err)
+			}
+		})
+	}
+}
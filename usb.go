@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/gift"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/karalabe/hid"
+	"golang.org/x/image/bmp"
+)
+
+// the paths of the devices that are currently open, which are left alone when looking for others.
+var usbOpen = make(map[string]bool)
+var usbOpenLock sync.Mutex
+
+// Opens the supported Stream Deck device attached via USB with the given serial number.  If serial
+// is empty, the first supported device found will be opened.  Devices that are already open are skipped.
+func OpenUSBDevice(serial string) (Device, error) {
+	for _, info := range hid.Enumerate(ElgatoVendorID, 0) {
+		if usbInUse(info) {
+			continue
+		} else if model := ModelByProductID(info.ProductID); model != nil {
+			// serials are compared the same way that usbDevice.Serial() reports them
+			if reported := strings.TrimSpace(info.Serial); serial == `` || reported == serial {
+				return openUSBDevice(model, info)
+			} else if reported == `` && probeSerial(model, info) == serial {
+				return openUSBDevice(model, info)
+			}
+		}
+	}
+
+	if serial != `` {
+		return nil, fmt.Errorf("no Stream Deck with serial %q found", serial)
+	} else {
+		return nil, fmt.Errorf("no supported Stream Deck devices found")
+	}
+}
+
+// read the serial number of a device that did not report one during enumeration, without resetting it
+// or otherwise disturbing it.
+func probeSerial(model *Model, info hid.DeviceInfo) string {
+	if device, err := info.Open(); err == nil {
+		defer device.Close()
+
+		var usb = &usbDevice{
+			model:  model,
+			info:   info,
+			device: device,
+		}
+
+		return usb.readSerial()
+	}
+
+	return ``
+}
+
+// Opens all supported Stream Deck devices attached via USB.  Devices that can't be opened are logged and
+// skipped, so that one bad device doesn't keep the others from being used; an error is only returned if
+// none of them could be opened.
+func OpenUSBDevices() ([]Device, error) {
+	var devices []Device
+	var lastErr error
+
+	for _, info := range hid.Enumerate(ElgatoVendorID, 0) {
+		if usbInUse(info) {
+			continue
+		} else if model := ModelByProductID(info.ProductID); model != nil {
+			if device, err := openUSBDevice(model, info); err == nil {
+				devices = append(devices, device)
+			} else {
+				log.Warningf("%s at %s: %v", model.Name, info.Path, err)
+				lastErr = err
+			}
+		}
+	}
+
+	if len(devices) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+
+		return nil, fmt.Errorf("no supported Stream Deck devices found")
+	}
+
+	return devices, nil
+}
+
+type usbDevice struct {
+	model     *Model
+	info      hid.DeviceInfo
+	device    *hid.Device
+	serial    string
+	listeners []KeyFunc
+	inputs    []InputFunc
+	keystate  []bool
+	dialstate []bool
+	closed    bool
+	lock      sync.Mutex
+}
+
+// return whether the given device is already open.
+func usbInUse(info hid.DeviceInfo) bool {
+	usbOpenLock.Lock()
+	defer usbOpenLock.Unlock()
+
+	return usbOpen[info.Path]
+}
+
+func setUSBInUse(info hid.DeviceInfo, open bool) {
+	usbOpenLock.Lock()
+	defer usbOpenLock.Unlock()
+
+	if open {
+		usbOpen[info.Path] = true
+	} else {
+		delete(usbOpen, info.Path)
+	}
+}
+
+func openUSBDevice(model *Model, info hid.DeviceInfo) (*usbDevice, error) {
+	if device, err := info.Open(); err == nil {
+		var usb = &usbDevice{
+			model:     model,
+			info:      info,
+			device:    device,
+			keystate:  make([]bool, model.Keys()),
+			dialstate: make([]bool, model.Dials),
+		}
+
+		if err := usb.reset(); err != nil {
+			device.Close()
+			return nil, err
+		}
+
+		if usb.serial = strings.TrimSpace(info.Serial); usb.serial == `` {
+			usb.serial = usb.readSerial()
+		}
+
+		setUSBInUse(info, true)
+
+		go usb.readLoop()
+
+		return usb, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *usbDevice) Model() *Model {
+	return self.model
+}
+
+func (self *usbDevice) Serial() string {
+	return self.serial
+}
+
+func (self *usbDevice) OnKey(fn KeyFunc) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.listeners = append(self.listeners, fn)
+}
+
+func (self *usbDevice) OnInput(fn InputFunc) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.inputs = append(self.inputs, fn)
+}
+
+func (self *usbDevice) WriteImage(index int, img image.Image) error {
+	if index < 0 || index >= self.model.Keys() {
+		return fmt.Errorf("key %d out of range", index)
+	}
+
+	if data, err := self.encode(img, self.model.KeySize, self.model.KeySize, true); err == nil {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		if self.model.legacy {
+			index = self.mirror(index)
+		}
+
+		switch self.model.generation {
+		case 1:
+			return self.writeGen1(index, data)
+		default:
+			return self.writeGen2(index, data)
+		}
+	} else {
+		return err
+	}
+}
+
+func (self *usbDevice) WriteStrip(img image.Image) error {
+	if !self.model.HasStrip() {
+		return fmt.Errorf("%s does not have a touch strip", self.model.Name)
+	}
+
+	if data, err := self.encode(img, self.model.StripW, self.model.StripH, false); err == nil {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		var w, h = self.model.StripW, self.model.StripH
+
+		return self.writePages(data, 1024, 16, func(page int, length int, last bool) []byte {
+			var header = []byte{
+				0x02,
+				0x0c,
+				0x00,
+				0x00,
+				0x00,
+				0x00,
+				byte(w & 0xff),
+				byte(w >> 8),
+				byte(h & 0xff),
+				byte(h >> 8),
+				0x00,
+				byte(page & 0xff),
+				byte(page >> 8),
+				byte(length & 0xff),
+				byte(length >> 8),
+				0x00,
+			}
+
+			if last {
+				header[10] = 0x01
+			}
+
+			return header
+		})
+	} else {
+		return err
+	}
+}
+
+func (self *usbDevice) Clear() error {
+	var blank = image.NewRGBA(image.Rect(0, 0, self.model.KeySize, self.model.KeySize))
+
+	draw.Draw(blank, blank.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	for i := 0; i < self.model.Keys(); i++ {
+		if err := self.WriteImage(i, blank); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *usbDevice) SetBrightness(percent int) error {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+
+	switch self.model.generation {
+	case 1:
+		return self.sendFeature(17, 0x05, 0x55, 0xaa, 0xd1, 0x01, byte(percent))
+	default:
+		return self.sendFeature(32, 0x03, 0x08, byte(percent))
+	}
+}
+
+func (self *usbDevice) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if !self.closed {
+		self.closed = true
+		setUSBInUse(self.info, false)
+		return self.device.Close()
+	}
+
+	return nil
+}
+
+func (self *usbDevice) reset() error {
+	switch self.model.generation {
+	case 1:
+		return self.sendFeature(17, 0x0b, 0x63)
+	default:
+		return self.sendFeature(32, 0x03, 0x02)
+	}
+}
+
+// some platforms do not report serial numbers during enumeration, so ask the device directly
+func (self *usbDevice) readSerial() string {
+	var report []byte
+	var offset int
+
+	switch self.model.generation {
+	case 1:
+		report = make([]byte, 17)
+		report[0] = 0x03
+		offset = 5
+	default:
+		report = make([]byte, 32)
+		report[0] = 0x06
+		offset = 2
+	}
+
+	if n, err := self.device.GetFeatureReport(report); err == nil && n > offset {
+		return strings.TrimSpace(strings.Trim(string(report[offset:n]), "\x00"))
+	}
+
+	return ``
+}
+
+func (self *usbDevice) sendFeature(length int, payload ...byte) error {
+	var report = make([]byte, length)
+	copy(report, payload)
+
+	_, err := self.device.SendFeatureReport(report)
+	return err
+}
+
+// continuously reads input reports from the device, emitting key events whenever a key
+// is pressed or released.
+func (self *usbDevice) readLoop() {
+	var report = make([]byte, 512)
+	var offset = 4
+
+	if self.model.generation == 1 {
+		offset = 1
+	}
+
+	for {
+		if n, err := self.device.Read(report); err == nil {
+			// gen2 devices with non-key inputs report the input type in the second byte
+			if self.model.generation == 2 && report[1] != 0x00 {
+				if n >= 14 {
+					self.readInput(report[:n])
+				}
+
+				continue
+			}
+
+			for i := 0; i < len(self.keystate) && offset+i < n; i++ {
+				var key = i
+				var pressed = (report[offset+i] == 1)
+
+				if self.model.legacy {
+					key = self.mirror(i)
+				}
+
+				if pressed != self.keystate[key] {
+					self.emit(key, pressed, nil)
+				}
+
+				self.keystate[key] = pressed
+			}
+		} else {
+			self.lock.Lock()
+			var closed = self.closed
+			self.lock.Unlock()
+
+			if !closed {
+				self.emit(-1, false, err)
+			}
+
+			return
+		}
+	}
+}
+
+// parses touch strip and dial input reports from the Stream Deck Plus
+func (self *usbDevice) readInput(report []byte) {
+	var u16 = func(i int) int {
+		return int(report[i]) | int(report[i+1])<<8
+	}
+
+	switch report[1] {
+	case 0x02:
+		var event = InputEvent{
+			X: u16(6),
+			Y: u16(8),
+		}
+
+		switch report[4] {
+		case 0x01:
+			event.Kind = Touch
+		case 0x02:
+			event.Kind = LongTouch
+		case 0x03:
+			event.Kind = Swipe
+			event.ToX = u16(10)
+			event.ToY = u16(12)
+		default:
+			return
+		}
+
+		self.emitInput(event)
+
+	case 0x03:
+		for i := 0; i < len(self.dialstate) && 5+i < len(report); i++ {
+			var value = report[5+i]
+
+			switch report[4] {
+			case 0x00:
+				var pressed = (value == 1)
+
+				if pressed != self.dialstate[i] {
+					var event = InputEvent{
+						Kind: DialRelease,
+						Dial: i,
+					}
+
+					if pressed {
+						event.Kind = DialPress
+					}
+
+					self.dialstate[i] = pressed
+					self.emitInput(event)
+				}
+			case 0x01:
+				if value != 0 {
+					self.emitInput(InputEvent{
+						Kind:  DialTurn,
+						Dial:  i,
+						Delta: int(int8(value)),
+					})
+				}
+			}
+		}
+	}
+}
+
+func (self *usbDevice) emitInput(event InputEvent) {
+	self.lock.Lock()
+	var inputs = make([]InputFunc, len(self.inputs))
+	copy(inputs, self.inputs)
+	self.lock.Unlock()
+
+	for _, fn := range inputs {
+		fn(event)
+	}
+}
+
+func (self *usbDevice) emit(index int, pressed bool, err error) {
+	self.lock.Lock()
+	var listeners = make([]KeyFunc, len(self.listeners))
+	copy(listeners, self.listeners)
+	self.lock.Unlock()
+
+	for _, fn := range listeners {
+		fn(index, pressed, err)
+	}
+}
+
+// the original Stream Deck numbers its keys right-to-left
+func (self *usbDevice) mirror(index int) int {
+	var col = index % self.model.Cols
+
+	return (index - col) + (self.model.Cols - 1 - col)
+}
+
+// scales and encodes the given image into the device's native image format.  If orient is true,
+// the image is also rotated and flipped the way the device's keys expect.
+func (self *usbDevice) encode(img image.Image, width int, height int, orient bool) ([]byte, error) {
+	var filters []gift.Filter
+	var buf bytes.Buffer
+
+	if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+		filters = append(filters, gift.Resize(width, height, gift.LanczosResampling))
+	}
+
+	if orient {
+		switch self.model.Rotation {
+		case 90:
+			filters = append(filters, gift.Rotate90())
+		case 180:
+			filters = append(filters, gift.Rotate180())
+		case 270:
+			filters = append(filters, gift.Rotate270())
+		}
+
+		if self.model.FlipX {
+			filters = append(filters, gift.FlipHorizontal())
+		}
+
+		if self.model.FlipY {
+			filters = append(filters, gift.FlipVertical())
+		}
+	}
+
+	var g = gift.New(filters...)
+	var native = image.NewRGBA(g.Bounds(img.Bounds()))
+
+	draw.Draw(native, native.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	g.DrawAt(native, img, image.Point{}, gift.OverOperator)
+
+	switch self.model.Encoding {
+	case EncodingBMP:
+		if err := bmp.Encode(&buf, native); err != nil {
+			return nil, err
+		}
+	default:
+		if err := jpeg.Encode(&buf, native, &jpeg.Options{
+			Quality: 95,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (self *usbDevice) writeGen1(index int, data []byte) error {
+	var reportLen = 1024
+	var headerLen = 16
+	var pageBase = 0
+
+	if self.model.legacy {
+		reportLen = 8191
+		pageBase = 1
+	}
+
+	return self.writePages(data, reportLen, headerLen, func(page int, length int, last bool) []byte {
+		var header = make([]byte, headerLen)
+
+		header[0] = 0x02
+		header[1] = 0x01
+		header[2] = byte(page + pageBase)
+		header[5] = byte(index + 1)
+
+		if last {
+			header[4] = 0x01
+		}
+
+		return header
+	})
+}
+
+func (self *usbDevice) writeGen2(index int, data []byte) error {
+	return self.writePages(data, 1024, 8, func(page int, length int, last bool) []byte {
+		var header = []byte{
+			0x02,
+			0x07,
+			byte(index),
+			0x00,
+			byte(length & 0xff),
+			byte(length >> 8),
+			byte(page & 0xff),
+			byte(page >> 8),
+		}
+
+		if last {
+			header[3] = 0x01
+		}
+
+		return header
+	})
+}
+
+// splits data into fixed-length output reports, each prefixed with a header generated for that page.
+func (self *usbDevice) writePages(data []byte, reportLen int, headerLen int, headerFn func(page int, length int, last bool) []byte) error {
+	var payloadLen = reportLen - headerLen
+	var remaining = len(data)
+
+	for page := 0; remaining > 0; page++ {
+		var length = remaining
+
+		if length > payloadLen {
+			length = payloadLen
+		}
+
+		var sent = page * payloadLen
+		var report = make([]byte, reportLen)
+
+		copy(report, headerFn(page, length, (length == remaining)))
+		copy(report[headerLen:], data[sent:sent+length])
+
+		if _, err := self.device.Write(report); err != nil {
+			return err
+		}
+
+		remaining -= length
+	}
+
+	return nil
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/stringutil"
+	"github.com/ghetzel/go-stockutil/timeutil"
+	yamlv2 "gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+)
+
+// A ConfigError describes a problem with a specific part of a deck configuration file.
+type ConfigError struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Message  string `json:"message"`
+}
+
+func (self *ConfigError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", self.Filename, self.Line, self.Column, self.Message)
+}
+
+// walks the YAML node tree of a deck configuration alongside the Go types it will be loaded into.
+type validator struct {
+	filename string
+	deck     *Deck
+	keys     int
+	dials    int
+	errors   []*ConfigError
+}
+
+// Check the deck's configuration file for problems that would otherwise be silently ignored (or cause
+// problems at runtime): unknown keys, unparseable colors and durations, references to helpers, icons and
+// pages that don't exist, and key and dial indices that are out of range for the given model.  If model is nil,
+// the rows and columns from the configuration are used, and failing that, the largest known model.
+//
+// The deck's own config file is checked, along with every file it includes.
+func (self *Deck) Validate(model *Model) ([]*ConfigError, error) {
+	var v = &validator{
+		deck: self,
+	}
+
+	if model != nil {
+		v.keys = model.Keys()
+		v.dials = model.Dials
+	} else if self.Rows > 0 && self.Cols > 0 {
+		v.keys = self.Rows * self.Cols
+	} else {
+		for _, m := range Models {
+			if m.Keys() > v.keys {
+				v.keys = m.Keys()
+			}
+
+			if m.Dials > v.dials {
+				v.dials = m.Dials
+			}
+		}
+	}
+
+	var files = self.files
+
+	if len(files) == 0 {
+		files = []string{self.Filename()}
+	}
+
+	for _, filename := range files {
+		var root yaml.Node
+		var errs = len(v.errors)
+
+		if data, err := fileutil.ReadAll(filename); err == nil {
+			if err := yaml.Unmarshal(data, &root); err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+		} else {
+			return nil, err
+		}
+
+		v.filename = filename
+
+		if len(root.Content) > 0 {
+			v.walk(root.Content[0], reflect.TypeOf(Deck{}))
+		}
+
+		var found = v.errors[errs:]
+
+		sort.SliceStable(found, func(i int, j int) bool {
+			if found[i].Line == found[j].Line {
+				return found[i].Column < found[j].Column
+			}
+
+			return found[i].Line < found[j].Line
+		})
+	}
+
+	return v.errors, nil
+}
+
+// return whether a deck that failed to load with the given error can still be validated.
+func isValidatable(err error) bool {
+	if err == nil {
+		return true
+	} else {
+		var _, ok = err.(*yamlv2.TypeError)
+		return ok
+	}
+}
+
+// validate the deck configuration and log any problems that are found.
+func (self *Deck) checkConfig() {
+	if errs, err := self.Validate(self.Model); err == nil {
+		for _, cerr := range errs {
+			log.Warningf("%v", cerr)
+		}
+	} else {
+		log.Warningf("deck %v: %v", self.ID(), err)
+	}
+}
+
+func (self *validator) errorf(node *yaml.Node, format string, args ...interface{}) {
+	self.errors = append(self.errors, &ConfigError{
+		Filename: self.filename,
+		Line:     node.Line,
+		Column:   node.Column,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// check that the given node can be decoded into the given type, and that its values make sense.
+func (self *validator) walk(node *yaml.Node, typ reflect.Type) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	// types from other packages (e.g.: data sources) are responsible for their own configuration
+	if typ.PkgPath() != `` && typ.PkgPath() != reflect.TypeOf(Deck{}).PkgPath() {
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		// helpers can be given as just their script
+		if typ == reflect.TypeOf(Helper{}) && node.Kind == yaml.ScalarNode {
+			return
+		}
+
+		if node.Kind != yaml.MappingNode {
+			if node.Tag != `!!null` {
+				self.errorf(node, "expected a mapping, got %s", describeNode(node))
+			}
+
+			return
+		}
+
+		var fields = yamlFields(typ)
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			var key = node.Content[i]
+			var value = node.Content[i+1]
+
+			if key.Value == `<<` {
+				continue
+			}
+
+			if field, ok := fields[key.Value]; ok {
+				// a single include doesn't need to be a list
+				if field.Name == `Include` && value.Kind == yaml.ScalarNode {
+					continue
+				}
+
+				self.walk(value, field.Type)
+				self.check(typ, field, value)
+			} else {
+				self.errorf(key, "unknown key %q in %s", key.Value, strings.ToLower(typ.Name()))
+			}
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			if node.Tag != `!!null` {
+				self.errorf(node, "expected a mapping, got %s", describeNode(node))
+			}
+
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			var key = node.Content[i]
+
+			switch typ.Key().Kind() {
+			case reflect.Int:
+				if _, err := strconv.Atoi(key.Value); err != nil {
+					self.errorf(key, "expected a number, got %q", key.Value)
+				}
+			}
+
+			self.walk(node.Content[i+1], typ.Elem())
+		}
+
+	case reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				self.walk(item, typ.Elem())
+			}
+		} else if node.Tag != `!!null` {
+			self.errorf(node, "expected a list, got %s", describeNode(node))
+		}
+
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			self.errorf(node, "expected a string, got %s", describeNode(node))
+		}
+
+	case reflect.Int, reflect.Float64:
+		if node.Kind != yaml.ScalarNode {
+			self.errorf(node, "expected a number, got %s", describeNode(node))
+		} else if _, err := strconv.ParseFloat(node.Value, 64); err != nil && node.Tag != `!!null` {
+			self.errorf(node, "expected a number, got %q", node.Value)
+		}
+
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || (node.Tag != `!!bool` && node.Tag != `!!null`) {
+			self.errorf(node, "expected true or false, got %s", describeNode(node))
+		}
+	}
+}
+
+// The kinds of values held by configuration fields whose Go type alone doesn't say enough about them.
+// These are shared by the validator and the JSON Schema.
+const (
+	colorField      = `color`
+	durationField   = `duration`
+	actionsField    = `actions`
+	iconField       = `icon`
+	helperField     = `helper`
+	pageField       = `page`
+	brightnessField = `brightness`
+	keyField        = `key`
+)
+
+var configFieldKinds = map[string]string{
+	`Button.Fill`:           colorField,
+	`Button.Color`:          colorField,
+	`Button.ProgressColor`:  colorField,
+	`Button.HoldThreshold`:  durationField,
+	`Page.Refresh`:          durationField,
+	`Page.IdleTimeout`:      durationField,
+	`IdleConfig.Timeout`:    durationField,
+	`Rule.Debounce`:         durationField,
+	`Helper.Timeout`:        durationField,
+	`Helper.Interval`:       durationField,
+	`Rule.Page`:             pageField,
+	`Rule.Action`:           actionsField,
+	`Button.Icon`:           iconField,
+	`Button.Action`:         actionsField,
+	`Button.OnPress`:        actionsField,
+	`Button.OnRelease`:      actionsField,
+	`Button.OnLongPress`:    actionsField,
+	`Button.OnDoubleTap`:    actionsField,
+	`Page.OnTouch`:          actionsField,
+	`Page.OnLongTouch`:      actionsField,
+	`Page.OnSwipeLeft`:      actionsField,
+	`Page.OnSwipeRight`:     actionsField,
+	`Page.OnEnter`:          actionsField,
+	`Page.OnExit`:           actionsField,
+	`Page.OnIdle`:           actionsField,
+	`Dial.OnTurn`:           actionsField,
+	`Dial.OnTurnLeft`:       actionsField,
+	`Dial.OnTurnRight`:      actionsField,
+	`Dial.OnPress`:          actionsField,
+	`Dial.OnRelease`:        actionsField,
+	`Dial.OnTouch`:          actionsField,
+	`Page.Helper`:           helperField,
+	`IdleConfig.Page`:       pageField,
+	`Page.Extends`:          pageField,
+	`Deck.Brightness`:       brightnessField,
+	`IdleConfig.Brightness`: brightnessField,
+	`Pagination.Prev`:       keyField,
+	`Pagination.Next`:       keyField,
+}
+
+// return the kind of value the given struct field holds, if it is one of the kinds in configFieldKinds.
+func configFieldKind(typ reflect.Type, field reflect.StructField) string {
+	return configFieldKinds[typ.Name()+`.`+field.Name]
+}
+
+// performs checks that are specific to individual fields.
+func (self *validator) check(typ reflect.Type, field reflect.StructField, node *yaml.Node) {
+	switch configFieldKind(typ, field) {
+	case colorField:
+		self.checkColor(node)
+	case durationField:
+		self.checkDuration(node)
+	case iconField:
+		if value, ok := literal(node); ok && value != `` {
+			if _, ok := self.deck.Icons[value]; !ok {
+				self.errorf(node, "icon %q is not defined", value)
+			}
+		}
+	case actionsField:
+		self.checkActions(node)
+	case helperField:
+		if value, ok := literal(node); ok && value != `` {
+			if _, ok := self.deck.Helpers[value]; !ok {
+				self.errorf(node, "helper %q is not defined", value)
+			}
+		}
+	case pageField:
+		if value, ok := literal(node); ok {
+			self.checkPage(node, value)
+		}
+	case brightnessField:
+		if v, err := strconv.Atoi(node.Value); err == nil && (v < 0 || v > 100) {
+			self.errorf(node, "brightness must be between 0 and 100, got %d", v)
+		}
+	case keyField:
+		if v, err := strconv.Atoi(node.Value); err == nil && (v < 1 || v > self.keys) {
+			self.errorf(node, "key %d is out of range (1-%d)", v, self.keys)
+		}
+	}
+
+	switch typ.Name() + `.` + field.Name {
+	case `Page.Buttons`:
+		// pages with more buttons than there are keys are paginated, so there's no upper limit
+		self.checkIndices(node, `button`, -1)
+	case `Page.Dials`:
+		self.checkIndices(node, `dial`, self.dials)
+	case `Helper.Mode`:
+		if value, ok := literal(node); ok && value != `` && !sliceutil.ContainsString(HelperModes, value) {
+			self.errorf(node, "unknown helper mode %q (must be one of: %s)", value, strings.Join(HelperModes, `, `))
+		}
+	case `Helper.Overlap`:
+		if value, ok := literal(node); ok && value != `` && !sliceutil.ContainsString(HelperOverlaps, value) {
+			self.errorf(node, "unknown helper overlap %q (must be one of: %s)", value, strings.Join(HelperOverlaps, `, `))
+		}
+	}
+}
+
+func (self *validator) checkColor(node *yaml.Node) {
+	if value, ok := literal(node); ok && value != `` {
+		if _, err := parseColor(value); err != nil {
+			self.errorf(node, "%v", err)
+		}
+	}
+}
+
+func (self *validator) checkDuration(node *yaml.Node) {
+	if value, ok := literal(node); ok && value != `` {
+		if _, err := timeutil.ParseDuration(value); err != nil {
+			self.errorf(node, "invalid duration %q", value)
+		}
+	}
+}
+
+// check that all actions are known, and that the pages referred to by "page:" and "replace:" actions exist.
+func (self *validator) checkActions(node *yaml.Node) {
+	if value, ok := literal(node); ok {
+		for _, actionPair := range strings.Split(value, MultiActionSeparator) {
+			var action, arg = stringutil.SplitPair(strings.TrimSpace(actionPair), `:`)
+
+			if action = strings.ToLower(action); action == `` {
+				continue
+			} else if !sliceutil.ContainsString(ActionVerbs, action) {
+				self.errorf(node, "unknown action %q", action)
+				continue
+			}
+
+			switch action {
+			case `page`, `replace`:
+				var pg, _ = stringutil.SplitPairTrimSpace(arg, `;`)
+
+				self.checkPage(node, pg)
+			}
+		}
+	}
+}
+
+func (self *validator) checkPage(node *yaml.Node, name string) {
+	if name != `` {
+		if _, ok := self.deck.Pages[name]; !ok {
+			self.errorf(node, "page %q does not exist", name)
+		}
+	}
+}
+
+func (self *validator) checkIndices(node *yaml.Node, kind string, max int) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		var key = node.Content[i]
+
+		if n, err := strconv.Atoi(key.Value); err == nil && (n < 1 || (max >= 0 && n > max)) {
+			if max < 0 {
+				self.errorf(key, "%s %d is out of range (must be at least 1)", kind, n)
+			} else if max > 0 {
+				self.errorf(key, "%s %d is out of range (1-%d)", kind, n, max)
+			} else {
+				self.errorf(key, "%s %d is out of range (device has no %ss)", kind, n, kind)
+			}
+		}
+	}
+}
+
+// return the value of a scalar node, so long as it does not contain a template (whose value cannot
+// be known until runtime).
+func literal(node *yaml.Node) (string, bool) {
+	if node.Kind != yaml.ScalarNode || node.Tag == `!!null` {
+		return ``, false
+	} else if strings.Contains(node.Value, `{{`) && strings.Contains(node.Value, `}}`) {
+		return ``, false
+	}
+
+	return node.Value, true
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return `a mapping`
+	case yaml.SequenceNode:
+		return `a list`
+	default:
+		return strconv.Quote(node.Value)
+	}
+}
+
+// return the exported fields of a struct, keyed on the name they are given in YAML.
+func yamlFields(typ reflect.Type) map[string]reflect.StructField {
+	var fields = make(map[string]reflect.StructField)
+
+	for i := 0; i < typ.NumField(); i++ {
+		var field = typ.Field(i)
+
+		if field.PkgPath != `` {
+			continue
+		}
+
+		var name, _ = stringutil.SplitPair(field.Tag.Get(`yaml`), `,`)
+
+		switch name {
+		case `-`:
+			continue
+		case ``:
+			name = strings.ToLower(field.Name)
+		}
+
+		fields[name] = field
+	}
+
+	return fields
+}
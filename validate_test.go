@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		files  map[string]string
+		errors []string
+	}{
+		{
+			name: `valid`,
+			files: map[string]string{
+				`deck.yaml`: "pages:\n  default:\n    buttons:\n      1: {text: one, action: 'page:other'}\n  other: {}\n",
+			},
+		}, {
+			name: `unknown keys`,
+			files: map[string]string{
+				`deck.yaml`: "pages:\n  default:\n    buttons:\n      1:\n        txt: one\n    colour: red\n",
+			},
+			errors: []string{
+				`deck.yaml:5:9: unknown key "txt" in button`,
+				`deck.yaml:6:5: unknown key "colour" in page`,
+			},
+		}, {
+			name: `bad values`,
+			files: map[string]string{
+				`deck.yaml`: "brightness: 150\npages:\n  default:\n    refresh: soon\n    dials:\n      1: {onTurn: 'page:default'}\n    buttons:\n      7: {action: 'page:nowhere'}\n",
+			},
+			errors: []string{
+				`deck.yaml:1:13: brightness must be between 0 and 100, got 150`,
+				`deck.yaml:4:14: invalid duration "soon"`,
+				`deck.yaml:6:7: dial 1 is out of range (device has no dials)`,
+				`deck.yaml:8:19: page "nowhere" does not exist`,
+			},
+		}, {
+			name: `included files`,
+			files: map[string]string{
+				`deck.yaml`:    "include: helpers.yaml\npages:\n  default: {helper: clock}\n",
+				`helpers.yaml`: "\nhelpers:\n  h: {mode: sometimes}\n",
+			},
+			errors: []string{
+				`helpers.yaml:3:13: unknown helper mode "sometimes" (must be one of: once, stream)`,
+				`deck.yaml:3:21: helper "clock" is not defined`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root = writeTestFiles(t, tt.files)
+			var deck, err = LoadDeck(filepath.Join(root, `deck.yaml`))
+
+			if !isValidatable(err) {
+				t.Fatal(err)
+			}
+
+			var errs, verr = deck.Validate(ModelByName(`mini`))
+			var got []string
+
+			if verr != nil {
+				t.Fatal(verr)
+			}
+
+			for _, cerr := range errs {
+				got = append(got, fmt.Sprintf("%s:%d:%d: %s", filepath.Base(cerr.Filename), cerr.Line, cerr.Column, cerr.Message))
+			}
+
+			if !reflect.DeepEqual(got, tt.errors) {
+				t.Fatalf("expected errors:\n%q\ngot:\n%q", tt.errors, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"os"
+
+	"github.com/disintegration/gift"
+	"github.com/ghetzel/go-stockutil/colorutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+// A wallpaper is a single image that has been scaled to cover the entire key panel of a deck, then
+// sliced into one tile per key.  Tiles are drawn underneath everything else on each key.
+type wallpaper struct {
+	filename string
+	model    *Model
+	gap      int
+	tiles    []image.Image
+}
+
+// return the wallpaper tile for the given (1-based) key index, loading the page's wallpaper if
+// it has not been loaded yet (or if any of the inputs to its layout have changed).
+func (self *Page) wallpaperTile(index int) image.Image {
+	if self.Wallpaper == `` || self.deck == nil {
+		return nil
+	}
+
+	var filename = self.deck.resolve(self.Wallpaper)
+	var model = self.deck.model()
+	var gap = model.Gap
+
+	if self.WallpaperGap != nil {
+		gap = *self.WallpaperGap
+	}
+
+	if wp := self.wallpaper; wp == nil || wp.filename != filename || wp.model != model || wp.gap != gap {
+		self.wallpaper = &wallpaper{
+			filename: filename,
+			model:    model,
+			gap:      gap,
+		}
+
+		if err := self.wallpaper.load(); err != nil {
+			log.Warningf("page %v: wallpaper: %v", self.Name, err)
+		}
+	}
+
+	if index > 0 && index <= len(self.wallpaper.tiles) {
+		return self.wallpaper.tiles[index-1]
+	}
+
+	return nil
+}
+
+// Scale the image to cover the full panel (including the gaps between keys, so that the picture
+// lines up across them), then cut out the portion of it that sits behind each key.  Animated
+// images use their first frame.
+func (self *wallpaper) load() error {
+	var src image.Image
+
+	if f, err := os.Open(self.filename); err == nil {
+		defer f.Close()
+
+		if img, _, err := image.Decode(f); err == nil {
+			src = img
+		} else {
+			return fmt.Errorf("%v: %v", self.filename, err)
+		}
+	} else {
+		return err
+	}
+
+	var model = self.model
+	var size = model.KeySize
+	var pitch = size + self.gap
+	var width = (model.Cols * pitch) - self.gap
+	var height = (model.Rows * pitch) - self.gap
+
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid panel size %dx%d", width, height)
+	}
+
+	var g = gift.New(gift.ResizeToFill(width, height, gift.LanczosResampling, gift.CenterAnchor))
+	var panel = image.NewRGBA(g.Bounds(src.Bounds()))
+
+	g.Draw(panel, src)
+
+	self.tiles = make([]image.Image, model.Keys())
+
+	for i := range self.tiles {
+		var x = (i % model.Cols) * pitch
+		var y = (i / model.Cols) * pitch
+		var tile = image.NewRGBA(image.Rect(0, 0, size, size))
+
+		draw.Draw(tile, tile.Bounds(), panel, image.Pt(x, y), draw.Src)
+		self.tiles[i] = tile
+	}
+
+	return nil
+}
+
+// return the wallpaper tile that sits behind this button, if any.  Touch strips do not show wallpaper.
+func (self *Button) wallpaperTile() image.Image {
+	if self.strip || self.page == nil {
+		return nil
+	}
+
+	return self.page.wallpaperTile(self.key())
+}
+
+// keys on a page with a wallpaper skip drawing an opaque black (i.e.: the default) fill so that
+// the wallpaper shows through.  Any other fill is drawn over it, so translucent fills can be used to tint it.
+func hidesWallpaper(fill colorutil.Color) bool {
+	var r, g, b, a = fill.RGBA255()
+
+	return !(r == 0 && g == 0 && b == 0 && a == 255)
+}